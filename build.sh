@@ -16,50 +16,91 @@ mkdir -p build/bundle/contrib
 version=$(node -p "require('./package.json').version")
 # echo "Building version $version"
 
+# With SOURCEMAPS set, every bundle gets a source map that leads back to src/ (used for the coverage of sdktest).
+esbuild_flags=""
+babel_flags=""
+if [ -n "${SOURCEMAPS:-}" ]; then
+    esbuild_flags="--sourcemap"
+    babel_flags="--source-maps"
+fi
+
+# Prepends the polyfills to a bundle. The source map of the bundle is moved down by the lines of the polyfills.
+add_polyfills() {
+    cat src/polyfill/polyfills.min.js "$1" > "$2"
+    if [ -n "${SOURCEMAPS:-}" ]; then
+        node -e '
+const fs = require("fs");
+const path = require("path");
+const [input, output, polyfills] = process.argv.slice(1);
+const lines = fs.readFileSync(polyfills, "utf8").split("\n").length - 1;
+const map = JSON.parse(fs.readFileSync(input + ".map", "utf8"));
+const indexMap = { version: 3, file: path.basename(output), sections: [{ offset: { line: lines, column: 0 }, map }] };
+fs.writeFileSync(output + ".map", JSON.stringify(indexMap));
+const code = fs.readFileSync(output, "utf8").replace(/\/\/# sourceMappingURL=\S+\s*$/, "");
+fs.writeFileSync(output, code + "//# sourceMappingURL=" + path.basename(output) + ".map\n");
+' "$1" "$2" src/polyfill/polyfills.min.js
+    fi
+}
+
+# Minifies a bundle, continuing its source map.
+minify() {
+    if [ -n "${SOURCEMAPS:-}" ]; then
+        terser "$1" -o "$2" --config-file ./terser.json --source-map "content='$1.map',url='$(basename "$2").map'"
+    else
+        terser "$1" -o "$2" --config-file ./terser.json
+    fi
+}
+
 # Build site and library entry
-esbuild src/entry/sdk.ts --bundle --outfile=build/bundle/sdk.js --format=esm --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof
-esbuild src/entry/sdk.ts --bundle --outfile=build/bundle/sdk.cjs --format=cjs --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof
+esbuild src/entry/sdk.ts --bundle --outfile=build/bundle/sdk.js --format=esm --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof $esbuild_flags
+esbuild src/entry/sdk.ts --bundle --outfile=build/bundle/sdk.cjs --format=cjs --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof $esbuild_flags
 
-esbuild src/entry/site.ts --bundle --outfile=build/bundle/site.js --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof
-esbuild src/entry/recaptcha-site.ts --bundle --outfile=build/bundle/contrib/recaptcha-site.js --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof
-esbuild src/entry/hcaptcha-site.ts --bundle --outfile=build/bundle/contrib/hcaptcha-site.js --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof
+esbuild src/entry/site.ts --bundle --outfile=build/bundle/site.js --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof $esbuild_flags
+esbuild src/entry/recaptcha-site.ts --bundle --outfile=build/bundle/contrib/recaptcha-site.js --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof $esbuild_flags
+esbuild src/entry/hcaptcha-site.ts --bundle --outfile=build/bundle/contrib/hcaptcha-site.js --target=es6 --define:SDK_VERSION=\"$version\" --legal-comments=eof $esbuild_flags
 
 # Babelize the site bundle
 
 if [ -z "${SKIP_BABEL:-}" ]; then
     echo "Running babel"
-    babel build/bundle/site.js -o build/bundle/site.compat.nopolyfill.js --config-file ./babel.config.cjs
-    babel build/bundle/contrib/recaptcha-site.js -o build/bundle/contrib/recaptcha-site.compat.nopolyfill.js --config-file ./babel.config.cjs
-    babel build/bundle/contrib/hcaptcha-site.js -o build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js --config-file ./babel.config.cjs
+    babel build/bundle/site.js -o build/bundle/site.compat.nopolyfill.js --config-file ./babel.config.cjs $babel_flags
+    babel build/bundle/contrib/recaptcha-site.js -o build/bundle/contrib/recaptcha-site.compat.nopolyfill.js --config-file ./babel.config.cjs $babel_flags
+    babel build/bundle/contrib/hcaptcha-site.js -o build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js --config-file ./babel.config.cjs $babel_flags
 else
     echo "Skipping babel"
     cp build/bundle/site.js build/bundle/site.compat.nopolyfill.js
     cp build/bundle/contrib/recaptcha-site.js build/bundle/contrib/recaptcha-site.compat.nopolyfill.js
     cp build/bundle/contrib/hcaptcha-site.js build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js
+    if [ -n "${SOURCEMAPS:-}" ]; then
+        cp build/bundle/site.js.map build/bundle/site.compat.nopolyfill.js.map
+        cp build/bundle/contrib/recaptcha-site.js.map build/bundle/contrib/recaptcha-site.compat.nopolyfill.js.map
+        cp build/bundle/contrib/hcaptcha-site.js.map build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js.map
+    fi
 fi
 
 # Add polyfills
-cat src/polyfill/polyfills.min.js build/bundle/site.compat.nopolyfill.js > build/bundle/site.compat.js
-cat src/polyfill/polyfills.min.js build/bundle/contrib/recaptcha-site.compat.nopolyfill.js > build/bundle/contrib/recaptcha-site.compat.js
-cat src/polyfill/polyfills.min.js build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js > build/bundle/contrib/hcaptcha-site.compat.js
+add_polyfills build/bundle/site.compat.nopolyfill.js build/bundle/site.compat.js
+add_polyfills build/bundle/contrib/recaptcha-site.compat.nopolyfill.js build/bundle/contrib/recaptcha-site.compat.js
+add_polyfills build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js build/bundle/contrib/hcaptcha-site.compat.js
 
 echo "Minifying"
 
 # Minify
-terser build/bundle/site.js -o build/bundle/site.min.js --config-file ./terser.json
-terser build/bundle/contrib/recaptcha-site.js -o build/bundle/contrib/recaptcha-site.min.js --config-file ./terser.json
-terser build/bundle/contrib/hcaptcha-site.js -o build/bundle/contrib/hcaptcha-site.min.js --config-file ./terser.json
+minify build/bundle/site.js build/bundle/site.min.js
+minify build/bundle/contrib/recaptcha-site.js build/bundle/contrib/recaptcha-site.min.js
+minify build/bundle/contrib/hcaptcha-site.js build/bundle/contrib/hcaptcha-site.min.js
 
-terser build/bundle/site.compat.js -o build/bundle/site.compat.min.js --config-file ./terser.json
-terser build/bundle/contrib/recaptcha-site.compat.js -o build/bundle/contrib/recaptcha-site.compat.min.js --config-file ./terser.json
-terser build/bundle/contrib/hcaptcha-site.compat.js -o build/bundle/contrib/hcaptcha-site.compat.min.js --config-file ./terser.json
+minify build/bundle/site.compat.js build/bundle/site.compat.min.js
+minify build/bundle/contrib/recaptcha-site.compat.js build/bundle/contrib/recaptcha-site.compat.min.js
+minify build/bundle/contrib/hcaptcha-site.compat.js build/bundle/contrib/hcaptcha-site.compat.min.js
 
 ############## Remove nopolyfill versions of recaptcha and hcaptcha compat builds.
 # I don't think nopolyfill version makes sense for site.js.. Users that really want it can minify it themselves.
 rm build/bundle/contrib/recaptcha-site.compat.nopolyfill.js
 rm build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js
+rm -f build/bundle/contrib/recaptcha-site.compat.nopolyfill.js.map build/bundle/contrib/hcaptcha-site.compat.nopolyfill.js.map
 
-terser build/bundle/site.compat.nopolyfill.js -o build/bundle/site.compat.nopolyfill.min.js --config-file ./terser.json
+minify build/bundle/site.compat.nopolyfill.js build/bundle/site.compat.nopolyfill.min.js
 
 echo "Copying to dist"
 
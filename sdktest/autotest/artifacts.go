@@ -0,0 +1,138 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Time we give the browser to capture the artifacts, the test itself may have used up all of `autotest.timeout`.
+const captureTimeout = 10 * time.Second
+
+// Serializes the test page and the iframes within it, cross-origin iframes (such as the real widget) can't be read.
+const serializeDOMScript = `(() => {
+	const frames = Array.from(document.querySelectorAll("iframe")).map((f) => {
+		let html = null;
+		try {
+			html = f.contentDocument ? "<!DOCTYPE html>\n" + f.contentDocument.documentElement.outerHTML : null;
+		} catch (e) {}
+		return { src: f.src, html: html };
+	});
+	return { html: "<!DOCTYPE html>\n" + document.documentElement.outerHTML, frames: frames };
+})()`
+
+type serializedDOM struct {
+	HTML   string `json:"html"`
+	Frames []struct {
+		Src  string  `json:"src"`
+		HTML *string `json:"html"`
+	} `json:"frames"`
+}
+
+// The folder the artifacts of a test are written to, empty if `autotest.artifacts_dir` is not set. The artifacts of
+// retries go into a subfolder per attempt, e.g. `<artifacts_dir>/csp/attempt-2/`.
+func (r *TestRunner) artifactsDir(tr *TestResult) string {
+	dir := r.k.String("autotest.artifacts_dir")
+	if dir == "" {
+		return ""
+	}
+	if tr.Attempt > 1 {
+		return filepath.Join(dir, tr.Name, fmt.Sprintf("attempt-%d", tr.Attempt))
+	}
+	return filepath.Join(dir, tr.Name)
+}
+
+// Writes an artifact of the test and adds it to the result.
+func (r *TestRunner) writeArtifact(tr *TestResult, name string, data []byte) error {
+	dir := r.artifactsDir(tr)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	tr.Artifacts = append(tr.Artifacts, path)
+	return nil
+}
+
+// Removes the artifacts of a previous run of the test, so they don't get mixed up with the ones of this run.
+func (r *TestRunner) clearArtifacts(tr *TestResult) {
+	if dir := r.artifactsDir(tr); dir != "" {
+		os.RemoveAll(dir)
+	}
+}
+
+// Writes the requests of the test as `network.har`, this is done for every test as passing tests can be just as
+// interesting when debugging networking issues.
+func (r *TestRunner) writeHAR(tr *TestResult, requests *networkRecorder, started time.Time) {
+	if r.artifactsDir(tr) == "" {
+		return
+	}
+
+	har, err := requests.HAR(tr.URL, started)
+	if err != nil {
+		tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("serializing HAR: %v", err))
+	} else if err := r.writeArtifact(tr, "network.har", har); err != nil {
+		tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("writing HAR: %v", err))
+	}
+}
+
+// Captures a full-page screenshot, the console log and the DOM of a failed test. This has a timeout of its own, so that
+// we can still capture after the test timed out.
+func (r *TestRunner) captureFailure(page Page, tr *TestResult) {
+	if r.artifactsDir(tr) == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), captureTimeout)
+	defer cancel()
+
+	screenshot, err := page.Screenshot(ctx)
+	if err != nil {
+		tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("capturing screenshot: %v", err))
+	} else if err := r.writeArtifact(tr, "screenshot.png", screenshot); err != nil {
+		tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("writing screenshot: %v", err))
+	}
+
+	if len(tr.Logs) > 0 {
+		lines := make([]string, 0, len(tr.Logs))
+		for _, e := range tr.Logs {
+			line := fmt.Sprintf("%s %s", e.Time.Format(time.RFC3339Nano), e)
+			if e.Stack != "" {
+				line += "\n" + e.Stack
+			}
+			lines = append(lines, line)
+		}
+		if err := r.writeArtifact(tr, "console.log", []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+			tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("writing console log: %v", err))
+		}
+	}
+
+	var dom serializedDOM
+	if err := page.Evaluate(ctx, serializeDOMScript, &dom); err != nil {
+		tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("serializing DOM: %v", err))
+		return
+	}
+	if err := r.writeArtifact(tr, "dom.html", []byte(dom.HTML)); err != nil {
+		tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("writing DOM: %v", err))
+		return
+	}
+	for i, f := range dom.Frames {
+		html := fmt.Sprintf("<!-- Cross-origin iframe, its DOM is not accessible: %s -->\n", f.Src)
+		if f.HTML != nil {
+			html = fmt.Sprintf("<!-- %s -->\n%s", f.Src, *f.HTML)
+		}
+		if err := r.writeArtifact(tr, fmt.Sprintf("iframe-%d.html", i), []byte(html)); err != nil {
+			tr.ArtifactErrors = append(tr.ArtifactErrors, fmt.Sprintf("writing iframe DOM: %v", err))
+		}
+	}
+}
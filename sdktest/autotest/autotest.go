@@ -9,10 +9,16 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"regexp"
 	"runtime"
+	"slices"
 	"time"
 
 	"github.com/fatih/color"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/mockapi"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/render"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/requestlog"
 	"github.com/knadh/koanf/v2"
 	"github.com/xxjwxc/gowp/workpool"
 )
@@ -21,7 +27,7 @@ func getConcurrency(k *koanf.Koanf) int {
 	con := k.Int("autotest.concurrency")
 
 	if con < 0 {
-		log.Fatal("Concurrency must be positive, or zero for number of cores")
+		fatalf("Concurrency must be positive, or zero for number of cores")
 	}
 
 	if con == 0 {
@@ -51,40 +57,157 @@ func findTests(k *koanf.Koanf) []string {
 	return names
 }
 
-func Start(k *koanf.Koanf) {
-	testNames := findTests(k)
+func mustCompileRegexp(k *koanf.Koanf, key string) *regexp.Regexp {
+	expr := k.String(key)
+	if expr == "" {
+		return nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		fatalf("Invalid regular expression for %s: %v", key, err)
+	}
+	return re
+}
+
+// Narrows down the tests to the ones given by name, `autotest.run`, `autotest.skip`, `autotest.tags` and `autotest.exclude_tags`.
+func selectTests(k *koanf.Koanf, names []string) []string {
+	tags := k.Strings("autotest.tags")
+	excludeTags := k.Strings("autotest.exclude_tags")
+
+	wanted := k.Strings("autotest.tests")
+	for _, w := range wanted {
+		if !slices.Contains(names, w) {
+			fatalf("Test %q does not exist in %s", w, k.MustString("test_folder"))
+		}
+	}
+
+	run := mustCompileRegexp(k, "autotest.run")
+	skip := mustCompileRegexp(k, "autotest.skip")
+
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		if len(wanted) > 0 && !slices.Contains(wanted, name) {
+			continue
+		}
+		if run != nil && !run.MatchString(name) {
+			continue
+		}
+		if skip != nil && skip.MatchString(name) {
+			continue
+		}
+		if len(tags) > 0 || len(excludeTags) > 0 {
+			conf, _ := render.LoadTestCaseConfig(k, k.MustString("test_folder"), name)
+			if len(tags) > 0 && !conf.Meta.HasAnyTag(tags) {
+				continue
+			}
+			if conf.Meta.HasAnyTag(excludeTags) {
+				continue
+			}
+		}
+		selected = append(selected, name)
+	}
+	return selected
+}
+
+// Loads the config of every test by name, so that invalid configs fail before any test runs.
+func loadTestConfigs(k *koanf.Koanf, names []string) map[string]config.Config {
+	confs := make(map[string]config.Config, len(names))
+	for _, name := range names {
+		conf, _ := render.LoadTestCaseConfig(k, k.MustString("test_folder"), name)
+		if onExceed := conf.Budgets.OnExceed; onExceed != "" && onExceed != "fail" && onExceed != "warn" {
+			fatalf("Invalid budgets.on_exceed %q in test %q, expected fail or warn", onExceed, name)
+		}
+		confs[name] = conf
+	}
+	return confs
+}
+
+func Start(k *koanf.Koanf, requestLog *requestlog.Store, mockAPI *mockapi.Server) {
+	testNames := selectTests(k, findTests(k))
 
 	if len(testNames) == 0 {
 		log.Printf("No test files found")
-		os.Exit(0)
+		os.Exit(ExitOK)
 	}
 
-	runner := NewTestRunner(k)
+	confs := loadTestConfigs(k, testNames)
+
+	runner := NewTestRunner(k, requestLog, mockAPI)
+
+	// In JSON mode stdout is reserved for the event stream, the human readable output goes to stderr.
+	out := color.Output
+	var events *eventWriter
+	if k.String("autotest.format") == "json" {
+		out = color.Error
+		events = newEventWriter(os.Stdout)
+	}
 
-	hadError := false
 	start := time.Now()
+	concurrency := getConcurrency(k)
 
-	wp := workpool.New(getConcurrency(k))
-	for _, p := range testNames {
-		name := p
-		wp.Do(func() error {
-			result := runner.runTest(name)
-			if result.Status == "FAIL" {
-				hadError = true
-			}
+	matrix := getMatrix(k)
 
-			runner.PrintTestResult(result)
-			return nil
-		})
+	results := newRunResults()
+
+	events.runStart(testNames, concurrency)
+	wp := workpool.New(concurrency)
+	for _, p := range testNames {
+		for _, v := range testMatrix(matrix, confs[p]) {
+			run := newTestRun(p, v)
+			wp.Do(func() error {
+				events.testStart(run.Variant.testName(run.Test), runner.testURL(run))
+				result := runner.runTest(run)
+				results.add(result)
+
+				if events != nil {
+					events.testEnd(result)
+				} else {
+					runner.PrintTestResult(result)
+				}
+				return nil
+			})
+		}
 	}
 	wp.Wait()
-	runner.cancelCtx()
+	browserName := runner.browser.Name()
+	runner.Close()
+
+	if path := k.String("autotest.reports.junit"); path != "" {
+		if err := writeJUnitReport(path, results.Results(), time.Since(start)); err != nil {
+			results.addHarnessError(fmt.Sprintf("Failed to write JUnit report: %v", err))
+		} else {
+			fmt.Fprintf(out, "%s\n", color.HiBlackString(fmt.Sprintf("Wrote JUnit report to %s", path)))
+		}
+	}
+
+	if dir := k.String("autotest.history_dir"); dir != "" {
+		if err := appendHistory(dir, browserName, results.Results(), start); err != nil {
+			results.addHarnessError(fmt.Sprintf("Failed to append to the history: %v", err))
+		} else {
+			fmt.Fprintf(out, "%s\n", color.HiBlackString(fmt.Sprintf("Added the run to the history in %s", dir)))
+		}
+	}
 
+	if runner.coverage != nil {
+		dir := k.String("autotest.coverage_dir")
+		if err := writeCoverage(out, runner.coverage, dir); err != nil {
+			results.addHarnessError(fmt.Sprintf("Failed to write the JS coverage: %v", err))
+		}
+	}
+
+	events.runSummary(results.Summary(time.Since(start)))
+	printFlakySummary(out, results.Results())
+	results.print(out)
+
+	exitCode := results.ExitCode()
 	timing := color.HiBlackString(fmt.Sprintf("(%s)", time.Since(start)))
-	if hadError {
-		fmt.Fprintf(color.Output, "\n%s %s\n", color.RedString("Done testing, one or more tests failed"), timing)
-	} else {
-		fmt.Fprintf(color.Output, "\n%s %s\n", color.CyanString("Done testing"), timing)
+	switch exitCode {
+	case ExitTestsFailed:
+		fmt.Fprintf(out, "\n%s %s\n", color.RedString("Done testing, one or more tests failed"), timing)
+	case ExitHarnessError:
+		fmt.Fprintf(out, "\n%s %s\n", color.RedString("Done testing, autotest failed to run one or more tests"), timing)
+	default:
+		fmt.Fprintf(out, "\n%s %s\n", color.CyanString("Done testing"), timing)
 	}
 
 	if k.Bool("autotest.serve") {
@@ -92,7 +215,5 @@ func Start(k *koanf.Koanf) {
 		<-done
 	}
 
-	if hadError {
-		os.Exit(1)
-	}
+	os.Exit(exitCode)
 }
@@ -0,0 +1,264 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/bidi"
+)
+
+// The events of Firefox are translated to the CDP events Chromium would send, so that the log collector and the
+// network recorder work the same for both browsers.
+
+type bidiStackTrace struct {
+	CallFrames []struct {
+		URL          string `json:"url"`
+		FunctionName string `json:"functionName"`
+		LineNumber   int64  `json:"lineNumber"`
+		ColumnNumber int64  `json:"columnNumber"`
+	} `json:"callFrames"`
+}
+
+func (st *bidiStackTrace) cdp() *runtime.StackTrace {
+	if st == nil {
+		return nil
+	}
+	frames := make([]*runtime.CallFrame, 0, len(st.CallFrames))
+	for _, f := range st.CallFrames {
+		frames = append(frames, &runtime.CallFrame{
+			URL:          f.URL,
+			FunctionName: f.FunctionName,
+			LineNumber:   f.LineNumber,
+			ColumnNumber: f.ColumnNumber,
+		})
+	}
+	return &runtime.StackTrace{CallFrames: frames}
+}
+
+type bidiLogEntry struct {
+	// "console" or "javascript" (uncaught errors)
+	Type string `json:"type"`
+	// "debug", "info", "warn" or "error"
+	Level  string `json:"level"`
+	Source struct {
+		Context string `json:"context"`
+	} `json:"source"`
+	Text *string `json:"text"`
+	// In milliseconds since the epoch.
+	Timestamp float64 `json:"timestamp"`
+	// The console method, e.g. "log" or "warn".
+	Method     string          `json:"method"`
+	StackTrace *bidiStackTrace `json:"stackTrace"`
+}
+
+type bidiHeader struct {
+	Name  string `json:"name"`
+	Value struct {
+		Value string `json:"value"`
+	} `json:"value"`
+}
+
+func bidiHeaders(headers []bidiHeader) network.Headers {
+	h := make(network.Headers, len(headers))
+	for _, header := range headers {
+		h[header.Name] = header.Value.Value
+	}
+	return h
+}
+
+func hasHeader(headers []bidiHeader, name string) bool {
+	for _, header := range headers {
+		if strings.EqualFold(header.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+type bidiResponse struct {
+	URL           string       `json:"url"`
+	Protocol      string       `json:"protocol"`
+	Status        int64        `json:"status"`
+	StatusText    string       `json:"statusText"`
+	Headers       []bidiHeader `json:"headers"`
+	MimeType      string       `json:"mimeType"`
+	BytesReceived float64      `json:"bytesReceived"`
+}
+
+func (r *bidiResponse) cdp() *network.Response {
+	return &network.Response{
+		URL:        r.URL,
+		Protocol:   r.Protocol,
+		Status:     r.Status,
+		StatusText: r.StatusText,
+		Headers:    bidiHeaders(r.Headers),
+		MimeType:   r.MimeType,
+	}
+}
+
+type bidiNetworkEvent struct {
+	Context *string `json:"context"`
+	// Set for the requests that navigate a browsing context.
+	Navigation *string `json:"navigation"`
+	Request    struct {
+		Request       string       `json:"request"`
+		URL           string       `json:"url"`
+		Method        string       `json:"method"`
+		Headers       []bidiHeader `json:"headers"`
+		Destination   string       `json:"destination"`
+		InitiatorType string       `json:"initiatorType"`
+	} `json:"request"`
+	// In milliseconds since the epoch.
+	Timestamp float64 `json:"timestamp"`
+	// Set for network.responseCompleted.
+	Response *bidiResponse `json:"response"`
+	// Set for network.fetchError.
+	ErrorText string `json:"errorText"`
+}
+
+// The CDP resource type of a request.
+func (e *bidiNetworkEvent) resourceType() network.ResourceType {
+	if e.Navigation != nil {
+		return network.ResourceTypeDocument
+	}
+	switch e.Request.InitiatorType {
+	case "fetch", "beacon":
+		return network.ResourceTypeFetch
+	case "xmlhttprequest":
+		return network.ResourceTypeXHR
+	}
+	switch e.Request.Destination {
+	case "document", "iframe", "frame":
+		return network.ResourceTypeDocument
+	case "script", "worker", "sharedworker":
+		return network.ResourceTypeScript
+	case "style":
+		return network.ResourceTypeStylesheet
+	case "image":
+		return network.ResourceTypeImage
+	case "font":
+		return network.ResourceTypeFont
+	}
+	return network.ResourceTypeOther
+}
+
+func bidiTime(ms float64) time.Time {
+	return time.UnixMicro(int64(ms * 1000))
+}
+
+// The browsing context an event happened in, empty if none (e.g. requests of a service worker).
+func eventContext(ev bidi.Event) string {
+	switch ev.Method {
+	case "log.entryAdded":
+		var entry bidiLogEntry
+		if json.Unmarshal(ev.Params, &entry) == nil {
+			return entry.Source.Context
+		}
+	case "network.beforeRequestSent", "network.responseCompleted", "network.fetchError":
+		var e bidiNetworkEvent
+		if json.Unmarshal(ev.Params, &e) == nil && e.Context != nil {
+			return *e.Context
+		}
+	}
+	return ""
+}
+
+// Handles an event of the page or one of its iframes, it is called from the read loop of the BiDi connection.
+func (p *firefoxPage) handle(contextID string, targetName string, ev bidi.Event) {
+	switch ev.Method {
+	case "log.entryAdded":
+		var entry bidiLogEntry
+		if json.Unmarshal(ev.Params, &entry) != nil {
+			return
+		}
+		e := LogEntry{
+			Time:     bidiTime(entry.Timestamp),
+			Source:   LogSourceConsole,
+			Level:    entry.Method,
+			Location: stackLocation(entry.StackTrace.cdp()),
+			Stack:    formatStackTrace(entry.StackTrace.cdp()),
+			Target:   targetName,
+		}
+		if entry.Text != nil {
+			e.Text = *entry.Text
+		}
+		if e.Level == "warn" {
+			e.Level = "warning"
+		}
+		if entry.Type == "javascript" {
+			e.Source = LogSourceException
+			e.Level = "error"
+		}
+		p.logs.add(e)
+	case "network.beforeRequestSent":
+		var e bidiNetworkEvent
+		if json.Unmarshal(ev.Params, &e) != nil {
+			return
+		}
+		if e.Navigation != nil && contextID != p.context {
+			// Iframes are named by the URL they navigate to.
+			p.browser.navigated(contextID, e.Request.URL)
+			targetName = e.Request.URL
+		}
+
+		wallTime := cdp.TimeSinceEpoch(bidiTime(e.Timestamp))
+		timestamp := cdp.MonotonicTime(bidiTime(e.Timestamp))
+		sent := &network.EventRequestWillBeSent{
+			RequestID: network.RequestID(e.Request.Request),
+			Request: &network.Request{
+				URL:     e.Request.URL,
+				Method:  e.Request.Method,
+				Headers: bidiHeaders(e.Request.Headers),
+			},
+			Timestamp: &timestamp,
+			WallTime:  &wallTime,
+			Type:      e.resourceType(),
+			FrameID:   cdp.FrameID(contextID),
+		}
+		// A redirect continues with the same request ID.
+		if redirect, ok := p.redirects[e.Request.Request]; ok {
+			sent.RedirectResponse = redirect.cdp()
+			delete(p.redirects, e.Request.Request)
+		}
+		p.requests.handle(targetName, sent)
+	case "network.responseCompleted":
+		var e bidiNetworkEvent
+		if json.Unmarshal(ev.Params, &e) != nil || e.Response == nil {
+			return
+		}
+		if e.Response.Status >= 300 && e.Response.Status < 400 && hasHeader(e.Response.Headers, "Location") {
+			p.redirects[e.Request.Request] = e.Response
+			return
+		}
+
+		timestamp := cdp.MonotonicTime(bidiTime(e.Timestamp))
+		p.requests.handle(targetName, &network.EventResponseReceived{
+			RequestID: network.RequestID(e.Request.Request),
+			Response:  e.Response.cdp(),
+		})
+		p.requests.handle(targetName, &network.EventLoadingFinished{
+			RequestID:         network.RequestID(e.Request.Request),
+			Timestamp:         &timestamp,
+			EncodedDataLength: e.Response.BytesReceived,
+		})
+	case "network.fetchError":
+		var e bidiNetworkEvent
+		if json.Unmarshal(ev.Params, &e) != nil {
+			return
+		}
+		timestamp := cdp.MonotonicTime(bidiTime(e.Timestamp))
+		p.requests.handle(targetName, &network.EventLoadingFailed{
+			RequestID: network.RequestID(e.Request.Request),
+			Timestamp: &timestamp,
+			ErrorText: e.ErrorText,
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+)
+
+// The binding the page calls to request something of the browser, see `sdktestlib/browser.ts`.
+const browserBindingName = "__sdktestBrowser"
+
+// A request from the page, e.g. `t.browser.click(".mock-widget", { frame: ".frc-i-widget" })`.
+type browserRequest struct {
+	ID int `json:"id"`
+	// "click", "type", "press" or "network"
+	Action string `json:"action"`
+	// The element to click.
+	Selector string `json:"selector"`
+	// Selector of the iframe (in the test page) the element is in, empty for elements of the test page itself.
+	Frame string `json:"frame"`
+	// The text to type.
+	Text string `json:"text"`
+	// The key to press, e.g. "Enter" or "Tab".
+	Key string `json:"key"`
+	// The network conditions to emulate.
+	Network *networkConditionsRequest `json:"network"`
+}
+
+// Network conditions as passed by `t.browser.setNetworkConditions`, the latency is in milliseconds.
+type networkConditionsRequest struct {
+	Offline            bool    `json:"offline"`
+	Latency            float64 `json:"latency"`
+	DownloadThroughput float64 `json:"downloadThroughput"`
+	UploadThroughput   float64 `json:"uploadThroughput"`
+}
+
+func (n networkConditionsRequest) conditions() config.NetworkConditions {
+	return config.NetworkConditions{
+		Offline:            n.Offline,
+		Latency:            time.Duration(n.Latency * float64(time.Millisecond)),
+		DownloadThroughput: n.DownloadThroughput,
+		UploadThroughput:   n.UploadThroughput,
+	}
+}
+
+// Lets the test page request things only the browser can do: trusted input (clicks and keystrokes) dispatched through
+// the CDP Input domain, and network emulation. Unlike events created in JS the input has `isTrusted` set, and it also
+// reaches into cross-origin iframes.
+type browserBridge struct {
+	page    context.Context
+	frames  *frameTargets
+	network *networkEmulator
+}
+
+// Exposes the binding to the page, must be run before navigating.
+func (b *browserBridge) install() error {
+	return chromedp.Run(b.page, runtime.AddBinding(browserBindingName))
+}
+
+// Handles the events of the test page, see listenPageAndFrames.
+func (b *browserBridge) handle(targetName string, ev any) {
+	called, ok := ev.(*runtime.EventBindingCalled)
+	if !ok || targetName != pageTargetName || called.Name != browserBindingName {
+		return
+	}
+
+	// We can't run actions from within a listener.
+	go func(payload string) {
+		var req browserRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			// Without an ID there's nobody to tell.
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(b.page, inputTimeout)
+		defer cancel()
+
+		err := b.dispatch(ctx, req)
+		b.resolve(req.ID, err)
+	}(called.Payload)
+}
+
+func (b *browserBridge) dispatch(ctx context.Context, req browserRequest) error {
+	switch req.Action {
+	case "click":
+		return b.click(ctx, req.Selector, req.Frame)
+	case "type":
+		return chromedp.Run(ctx, chromedp.KeyEvent(req.Text))
+	case "press":
+		return b.press(ctx, req.Key)
+	case "network":
+		if req.Network == nil {
+			return fmt.Errorf("no network conditions given")
+		}
+		return b.network.set(ctx, req.Network.conditions())
+	default:
+		return fmt.Errorf("unknown action %q", req.Action)
+	}
+}
+
+// Tells the page the request is done.
+func (b *browserBridge) resolve(id int, err error) {
+	errMsg := "null"
+	if err != nil {
+		errMsg = jsString(err.Error())
+	}
+	chromedp.Run(b.page, chromedp.Evaluate(fmt.Sprintf("window.__sdktestBrowserResolve && window.__sdktestBrowserResolve(%d, %s)", id, errMsg), nil))
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"errors"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/knadh/koanf/v2"
+)
+
+// A browser driver that autotest runs the test pages with, selected with `autotest.browser`.
+type Browser interface {
+	// e.g. "chromium" or "firefox"
+	Name() string
+	// Opens a new tab for a run of a test, the page reports its console output to logs and its requests to requests.
+	// The tab is set up for the test (e.g. its emulation profile) but stays blank until Open is called.
+	NewPage(run testRun, conf config.Config, logs *logCollector, requests *networkRecorder) (Page, error)
+	// Closes the browser, after which no more pages can be opened.
+	Close()
+}
+
+// A tab of a Browser that runs a single test page. All methods give up when ctx is done.
+type Page interface {
+	// Loads the test page and waits for its test suite to be ready to start.
+	Open(ctx context.Context, url string) error
+	// Continues on another page of the test (see `sdktest.navigate()`), the network conditions aren't started over.
+	Navigate(ctx context.Context, url string) error
+	// Reloads the current page (see `sdktest.reload()`).
+	Reload(ctx context.Context) error
+	// Evaluates a JS expression in the test page, awaiting it if it is a promise, and unmarshals the JSON of its value
+	// into res unless it is nil.
+	Evaluate(ctx context.Context, expression string, res any) error
+	// Captures a PNG screenshot of the full test page.
+	Screenshot(ctx context.Context) ([]byte, error)
+	// Closes the tab.
+	Close()
+}
+
+// The browser drivers by name, they connect to the browser at remoteURL instead of launching one if it is set.
+var browsers = map[string]func(k *koanf.Koanf, remoteURL string) (Browser, error){
+	"chromium": newChromiumBrowser,
+	"firefox":  newFirefoxBrowser,
+}
+
+// The URLs of `autotest.remote_debugging_url`, which is either a single URL or a list of them.
+func remoteDebuggingURLs(k *koanf.Koanf) []string {
+	if url, ok := k.Get("autotest.remote_debugging_url").(string); ok {
+		if url == "" {
+			return nil
+		}
+		return []string{url}
+	}
+	return k.Strings("autotest.remote_debugging_url")
+}
+
+// Launches (or connects to) the browser of `autotest.browser`, Chromium if not set. With more than one instance (see
+// `autotest.instances`) the tests are spread across them.
+func newBrowser(k *koanf.Koanf) Browser {
+	name := k.String("autotest.browser")
+	if name == "" {
+		name = "chromium"
+	}
+
+	launch, ok := browsers[name]
+	if !ok {
+		fatalf("Unknown browser %q in autotest.browser, expected chromium or firefox", name)
+	}
+
+	urls := remoteDebuggingURLs(k)
+	instances := max(k.Int("autotest.instances"), len(urls), 1)
+
+	pool := &browserPool{}
+	for i := range instances {
+		remoteURL := ""
+		if len(urls) > 0 {
+			remoteURL = urls[i%len(urls)]
+		}
+
+		b, err := launch(k, remoteURL)
+		if err != nil {
+			pool.Close()
+			if remoteURL != "" {
+				fatalf("Failed to connect to %s at %s: %v", name, remoteURL, err)
+			}
+			fatalf("Failed to launch %s: %v", name, err)
+		}
+		pool.add(b)
+	}
+
+	if instances == 1 {
+		return pool.instances[0].Browser
+	}
+	return pool
+}
+
+// An error of a step of running a test page in the browser, the step is reported as the message of the test result.
+type stepError struct {
+	step string
+	err  error
+}
+
+func (e *stepError) Error() string {
+	return e.step + ": " + e.err.Error()
+}
+
+func (e *stepError) Unwrap() error {
+	return e.err
+}
+
+// Fills in the internal error of the result, with the step that failed as the message.
+func (tr *TestResult) setInternalError(err error, step string) {
+	var stepErr *stepError
+	if errors.As(err, &stepErr) {
+		tr.InternalError = stepErr.err
+		tr.Message = stepErr.step
+		return
+	}
+	tr.InternalError = err
+	tr.Message = step
+}
@@ -0,0 +1,276 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chromedp/cdproto/profiler"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/coverage"
+	"github.com/knadh/koanf/v2"
+)
+
+// Drives Chromium (or Chrome) through the Chrome DevTools Protocol with chromedp.
+type chromiumBrowser struct {
+	// The context of the first tab, new tabs are opened from it.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Launches Chromium, or connects to the one at remoteURL if set.
+func newChromiumBrowser(k *koanf.Koanf, remoteURL string) (Browser, error) {
+	var allocCtx context.Context
+	var cancel context.CancelFunc
+	var ctxOpts []chromedp.ContextOption
+	if remoteURL != "" {
+		allocCtx, cancel = chromedp.NewRemoteAllocator(context.Background(), remoteURL)
+		// The remote browser may be shared with other instances (or other CI jobs), a browser context of our own keeps
+		// our cookies, storage and cache apart. It is disposed when we are done.
+		ctxOpts = append(ctxOpts, chromedp.WithNewBrowserContext())
+	} else {
+		opts := defaultAllocatorOptions[:]
+
+		if k.Bool("autotest.headless") {
+			opts = append(opts, chromedp.Headless)
+		}
+		execPath := k.String("autotest.browser_exec_path")
+		if execPath != "" {
+			opts = append(opts, chromedp.ExecPath(execPath))
+		}
+
+		allocCtx, cancel = chromedp.NewExecAllocator(context.Background(), opts...)
+	}
+	taskCtx, cancelTask := chromedp.NewContext(allocCtx, ctxOpts...)
+
+	// ensure the first tab is created (this way the browser doesn't keep getting closed)
+	if err := chromedp.Run(taskCtx); err != nil {
+		cancelTask()
+		cancel()
+		return nil, err
+	}
+
+	return &chromiumBrowser{
+		ctx: taskCtx,
+		cancel: func() {
+			// Closes the tab (and disposes our browser context) before disconnecting or killing the browser.
+			cancelTask()
+			cancel()
+		},
+	}, nil
+}
+
+func (b *chromiumBrowser) Name() string {
+	return "chromium"
+}
+
+func (b *chromiumBrowser) Close() {
+	b.cancel()
+}
+
+type chromiumPage struct {
+	// The chromedp context of the tab, cancelling it closes the tab.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	bridge  *browserBridge
+	network config.Network
+
+	// Whether JS coverage is being collected, and the coverage taken from the pages that were navigated away from.
+	coverageStarted bool
+	coverage        []coverage.Script
+}
+
+func (b *chromiumBrowser) NewPage(run testRun, conf config.Config, logs *logCollector, requests *networkRecorder) (Page, error) {
+	var opts []chromedp.ContextOption
+	if !conf.SharedBrowserContext {
+		// A fresh incognito context keeps cookies, storage and cache from leaking between tests, it is disposed along
+		// with the tab.
+		opts = append(opts, chromedp.WithNewBrowserContext())
+	}
+	tabCtx, cancel := chromedp.NewContext(b.ctx, opts...)
+	p := &chromiumPage{
+		ctx:     tabCtx,
+		cancel:  cancel,
+		bridge:  &browserBridge{page: tabCtx},
+		network: conf.Network,
+	}
+
+	p.bridge.frames = listenPageAndFrames(tabCtx, func(targetName string, ev any) {
+		logs.handle(targetName, ev)
+		requests.handle(targetName, ev)
+		p.bridge.handle(targetName, ev)
+	}, logs.attachError)
+	p.bridge.network = newNetworkEmulator(p.bridge.frames)
+
+	// Opens the tab.
+	if err := chromedp.Run(tabCtx); err != nil {
+		cancel()
+		return nil, &stepError{"opening a new tab", err}
+	}
+
+	if err := p.bridge.install(); err != nil {
+		cancel()
+		return nil, &stepError{"exposing the browser bridge to the page", err}
+	}
+
+	if run.Variant.Profile != "" {
+		profile, ok := conf.Profiles[run.Variant.Profile]
+		if !ok {
+			cancel()
+			return nil, &stepError{"loading the emulation profile", fmt.Errorf("emulation profile %q isn't defined under profiles", run.Variant.Profile)}
+		}
+		if err := emulateProfile(tabCtx, p.bridge.frames, profile); err != nil {
+			cancel()
+			return nil, &stepError{"emulating the device", err}
+		}
+	}
+
+	return p, nil
+}
+
+// A context of the tab that is also done when ctx is, chromedp needs its own context to find the tab.
+func (p *chromiumPage) bound(ctx context.Context) (context.Context, context.CancelFunc) {
+	var tabCtx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		tabCtx, cancel = context.WithDeadline(p.ctx, deadline)
+	} else {
+		tabCtx, cancel = context.WithCancel(p.ctx)
+	}
+	stop := context.AfterFunc(ctx, cancel)
+	return tabCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (p *chromiumPage) Open(ctx context.Context, url string) error {
+	// Started right before navigating, so the changes of the network conditions are relative to the page loading. The
+	// changes are scheduled on the tab, so that they outlive ctx.
+	if err := p.bridge.network.start(p.ctx, p.network); err != nil {
+		return &stepError{"emulating network conditions", err}
+	}
+	return p.Navigate(ctx, url)
+}
+
+func (p *chromiumPage) Navigate(ctx context.Context, url string) error {
+	ctx, cancel := p.bound(ctx)
+	defer cancel()
+
+	if err := p.takeCoverage(ctx); err != nil {
+		return &stepError{"taking JS coverage", err}
+	}
+
+	if err := chromedp.Run(ctx, chromedp.Navigate(url)); err != nil {
+		return &stepError{"waiting for browser to open page", err}
+	}
+	return p.waitReady(ctx)
+}
+
+func (p *chromiumPage) Reload(ctx context.Context) error {
+	ctx, cancel := p.bound(ctx)
+	defer cancel()
+
+	if err := p.takeCoverage(ctx); err != nil {
+		return &stepError{"taking JS coverage", err}
+	}
+
+	if err := chromedp.Run(ctx, chromedp.Reload()); err != nil {
+		return &stepError{"waiting for browser to reload page", err}
+	}
+	return p.waitReady(ctx)
+}
+
+// Waits for the test suite of the page that was just loaded to be ready to start.
+func (p *chromiumPage) waitReady(ctx context.Context) error {
+	if err := chromedp.Run(ctx, chromedp.WaitReady("body")); err != nil {
+		return &stepError{"waiting for body", err}
+	}
+
+	if err := chromedp.Run(ctx, chromedp.WaitReady(".sdktest-start")); err != nil {
+		return &stepError{"waiting to start", err}
+	}
+
+	// We click so that the browser is focused, otherwise the focus event doesn't work in some cases for form elements.
+	chromedp.Run(ctx, chromedp.MouseClickXY(0, 0))
+	return nil
+}
+
+func (p *chromiumPage) Evaluate(ctx context.Context, expression string, res any) error {
+	ctx, cancel := p.bound(ctx)
+	defer cancel()
+
+	return chromedp.Run(ctx, chromedp.Evaluate(expression, res, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}))
+}
+
+func (p *chromiumPage) Screenshot(ctx context.Context) ([]byte, error) {
+	ctx, cancel := p.bound(ctx)
+	defer cancel()
+
+	var screenshot []byte
+	// A quality of 100 gives us a PNG.
+	err := chromedp.Run(ctx, chromedp.FullScreenshot(&screenshot, 100))
+	return screenshot, err
+}
+
+func (p *chromiumPage) StartCoverage(ctx context.Context) error {
+	ctx, cancel := p.bound(ctx)
+	defer cancel()
+
+	err := chromedp.Run(ctx, profiler.Enable(), chromedp.ActionFunc(func(ctx context.Context) error {
+		_, err := profiler.StartPreciseCoverage().WithCallCount(true).WithDetailed(true).Do(ctx)
+		return err
+	}))
+	p.coverageStarted = err == nil
+	return err
+}
+
+// Takes the coverage of the current page before it is navigated away from, the scripts of the page may be gone after.
+// Taking it resets the counts, so the coverage of each page is only taken once.
+func (p *chromiumPage) takeCoverage(ctx context.Context) error {
+	if !p.coverageStarted {
+		return nil
+	}
+	return chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		scripts, _, err := profiler.TakePreciseCoverage().Do(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range scripts {
+			script := coverage.Script{URL: s.URL}
+			for _, f := range s.Functions {
+				function := coverage.Function{Name: f.FunctionName}
+				for _, r := range f.Ranges {
+					function.Ranges = append(function.Ranges, coverage.Range{
+						StartOffset: int(r.StartOffset),
+						EndOffset:   int(r.EndOffset),
+						Count:       int(r.Count),
+					})
+				}
+				script.Functions = append(script.Functions, function)
+			}
+			p.coverage = append(p.coverage, script)
+		}
+		return nil
+	}))
+}
+
+func (p *chromiumPage) Coverage(ctx context.Context) ([]coverage.Script, error) {
+	ctx, cancel := p.bound(ctx)
+	defer cancel()
+
+	err := p.takeCoverage(ctx)
+	return p.coverage, err
+}
+
+func (p *chromiumPage) Close() {
+	p.cancel()
+}
@@ -0,0 +1,202 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/log"
+	"github.com/chromedp/cdproto/runtime"
+)
+
+type LogSource string
+
+const (
+	// `console.log(...)` and friends.
+	LogSourceConsole LogSource = "console"
+	// Uncaught errors and unhandled promise rejections.
+	LogSourceException LogSource = "exception"
+	// Messages from the browser itself, such as CSP violations and failed network requests.
+	LogSourceBrowser LogSource = "browser"
+)
+
+// A console message, uncaught error or browser log message of a test page or one of its iframes.
+type LogEntry struct {
+	Time   time.Time `json:"time"`
+	Source LogSource `json:"source"`
+	// e.g. "log", "warning" or "error"
+	Level string `json:"level"`
+	Text  string `json:"text"`
+	// Where the message originated from, if known, e.g. `https://example.com/site.js:12`.
+	Location string `json:"location,omitempty"`
+	Stack    string `json:"stack,omitempty"`
+	// "page" for the test page itself, or the URL of the out-of-process iframe (such as the widget) it was logged in.
+	Target string `json:"target"`
+}
+
+func (e LogEntry) String() string {
+	s := fmt.Sprintf("[%s] %s", e.Level, e.Text)
+	if e.Location != "" {
+		s += fmt.Sprintf(" (%s)", e.Location)
+	}
+	if e.Target != pageTargetName {
+		s += fmt.Sprintf(" [%s]", e.Target)
+	}
+	return s
+}
+
+// Whether the entry is an error, for example a failed assertion or an uncaught error.
+func (e LogEntry) IsError() bool {
+	return e.Level == "error" || e.Level == "assert"
+}
+
+// Collects the log entries of a test page and all of its iframes.
+type logCollector struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+func newLogCollector() *logCollector {
+	return &logCollector{}
+}
+
+func (c *logCollector) add(e LogEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, e)
+}
+
+// The entries collected so far, in the order they were received.
+func (c *logCollector) Entries() []LogEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]LogEntry(nil), c.entries...)
+}
+
+// Records that we couldn't attach to an iframe, so its logs are missing.
+func (c *logCollector) attachError(targetName string, err error) {
+	c.add(LogEntry{
+		Time:   time.Now(),
+		Source: LogSourceBrowser,
+		Level:  "warning",
+		Text:   fmt.Sprintf("autotest could not attach to iframe, its logs and requests are missing: %v", err),
+		Target: targetName,
+	})
+}
+
+// Handles the events of the page or iframe with given name, see listenPageAndFrames.
+func (c *logCollector) handle(targetName string, ev any) {
+	switch ev := ev.(type) {
+	case *runtime.EventConsoleAPICalled:
+		args := make([]string, 0, len(ev.Args))
+		for _, arg := range ev.Args {
+			args = append(args, formatRemoteObject(arg))
+		}
+		level := string(ev.Type)
+		if ev.Type == runtime.APITypeWarning {
+			level = "warning"
+		}
+		c.add(LogEntry{
+			Time:     timestampTime(ev.Timestamp),
+			Source:   LogSourceConsole,
+			Level:    level,
+			Text:     strings.Join(args, " "),
+			Location: stackLocation(ev.StackTrace),
+			Stack:    formatStackTrace(ev.StackTrace),
+			Target:   targetName,
+		})
+	case *runtime.EventExceptionThrown:
+		details := ev.ExceptionDetails
+		text := details.Text
+		if details.Exception != nil {
+			// The description of an Error contains its message followed by the stack, which we report separately.
+			description, _, _ := strings.Cut(formatRemoteObject(details.Exception), "\n")
+			text = fmt.Sprintf("%s %s", details.Text, description)
+		}
+		location := stackLocation(details.StackTrace)
+		if location == "" && details.URL != "" {
+			location = fmt.Sprintf("%s:%d", details.URL, details.LineNumber+1)
+		}
+		c.add(LogEntry{
+			Time:     timestampTime(ev.Timestamp),
+			Source:   LogSourceException,
+			Level:    "error",
+			Text:     text,
+			Location: location,
+			Stack:    formatStackTrace(details.StackTrace),
+			Target:   targetName,
+		})
+	case *log.EventEntryAdded:
+		entry := ev.Entry
+		location := stackLocation(entry.StackTrace)
+		if location == "" && entry.URL != "" {
+			location = fmt.Sprintf("%s:%d", entry.URL, entry.LineNumber+1)
+		}
+		c.add(LogEntry{
+			Time:     timestampTime(entry.Timestamp),
+			Source:   LogSourceBrowser,
+			Level:    string(entry.Level),
+			Text:     fmt.Sprintf("%s: %s", entry.Source, entry.Text),
+			Location: location,
+			Stack:    formatStackTrace(entry.StackTrace),
+			Target:   targetName,
+		})
+	}
+}
+
+func timestampTime(t *runtime.Timestamp) time.Time {
+	if t == nil {
+		return time.Now()
+	}
+	return t.Time()
+}
+
+// Formats a console argument roughly the way the devtools console would.
+func formatRemoteObject(o *runtime.RemoteObject) string {
+	if o.Type == runtime.TypeString {
+		var s string
+		if err := json.Unmarshal(o.Value, &s); err == nil {
+			return s
+		}
+	}
+	if o.Description != "" {
+		return o.Description
+	}
+	if len(o.Value) > 0 {
+		return string(o.Value)
+	}
+	if o.UnserializableValue != "" {
+		return string(o.UnserializableValue)
+	}
+	return string(o.Type)
+}
+
+// The location of the top stack frame, e.g. `https://example.com/site.js:12:3`.
+func stackLocation(st *runtime.StackTrace) string {
+	if st == nil || len(st.CallFrames) == 0 {
+		return ""
+	}
+	f := st.CallFrames[0]
+	return fmt.Sprintf("%s:%d:%d", f.URL, f.LineNumber+1, f.ColumnNumber+1)
+}
+
+func formatStackTrace(st *runtime.StackTrace) string {
+	if st == nil {
+		return ""
+	}
+	lines := make([]string, 0, len(st.CallFrames))
+	for _, f := range st.CallFrames {
+		name := f.FunctionName
+		if name == "" {
+			name = "<anonymous>"
+		}
+		lines = append(lines, fmt.Sprintf("    at %s (%s:%d:%d)", name, f.URL, f.LineNumber+1, f.ColumnNumber+1))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/fatih/color"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/coverage"
+)
+
+// The dist folder the sdktest server serves the SDK bundles from, see server.NewSDKTestServer.
+const distFolder = "../dist"
+
+// A Page that can collect the JS coverage of the scripts it runs, only chromium supports this.
+type coveragePage interface {
+	// Starts collecting coverage, before the test page is opened.
+	StartCoverage(ctx context.Context) error
+	// The coverage of the scripts that ran since StartCoverage, on all pages of the test.
+	Coverage(ctx context.Context) ([]coverage.Script, error)
+}
+
+// The collector of the JS coverage of the run, nil if `autotest.coverage_dir` isn't set or the browser can't collect
+// coverage.
+func newCoverageCollector(dir string, browser Browser) *coverage.Collector {
+	if dir == "" {
+		return nil
+	}
+	if browser.Name() != "chromium" {
+		color.New(color.FgYellow).Fprintf(color.Error, "JS coverage can only be collected in chromium, not in %s\n", browser.Name())
+		return nil
+	}
+	return coverage.NewCollector(distFolder)
+}
+
+// The page as a coveragePage, looking through wrappers such as the pages of a browserPool.
+func asCoveragePage(page Page) (coveragePage, bool) {
+	for {
+		if cp, ok := page.(coveragePage); ok {
+			return cp, true
+		}
+		w, ok := page.(interface{ Unwrap() Page })
+		if !ok {
+			return nil, false
+		}
+		page = w.Unwrap()
+	}
+}
+
+func (r *TestRunner) startCoverage(ctx context.Context, page Page) error {
+	if r.coverage == nil {
+		return nil
+	}
+	cp, ok := asCoveragePage(page)
+	if !ok {
+		return errors.New("the page can't collect JS coverage")
+	}
+	return cp.StartCoverage(ctx)
+}
+
+// Adds the coverage of the test to that of the run, also for tests that failed as they still ran the SDK.
+func (r *TestRunner) collectCoverage(page Page, tr *TestResult) {
+	if r.coverage == nil {
+		return
+	}
+	cp, ok := asCoveragePage(page)
+	if !ok {
+		tr.Warnings = append(tr.Warnings, "Failed to collect JS coverage: the page can't collect it")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), captureTimeout)
+	defer cancel()
+	scripts, err := cp.Coverage(ctx)
+	if err != nil {
+		tr.Warnings = append(tr.Warnings, fmt.Sprintf("Failed to collect JS coverage: %v", err))
+	}
+	r.coverage.Add(scripts)
+}
+
+// Writes the coverage of the run as lcov and HTML reports to dir.
+func writeCoverage(out io.Writer, collector *coverage.Collector, dir string) error {
+	report, err := collector.Write(dir)
+	if err != nil {
+		return err
+	}
+
+	hit, total := report.Lines()
+	summary := fmt.Sprintf("of %d lines in %d files", total, len(report.Files))
+	if total > 0 {
+		summary = fmt.Sprintf("%.1f%% %s", float64(hit)/float64(total)*100, summary)
+	}
+	fmt.Fprintf(out, "%s\n", color.HiBlackString(fmt.Sprintf("Wrote JS coverage (%s) to %s", summary, filepath.Join(dir, coverage.HTMLFileName))))
+	for _, bundle := range slices.Sorted(maps.Keys(report.Problems)) {
+		fmt.Fprintf(out, "%s\n", color.YellowString(fmt.Sprintf("  No coverage of %s: %s", bundle, report.Problems[bundle])))
+	}
+	return nil
+}
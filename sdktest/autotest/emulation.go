@@ -0,0 +1,93 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+)
+
+// Emulates the profile in the test page, and in its out-of-process iframes as we attach to them. The iframes get
+// everything but the viewport, which is that of the page. Must be run before navigating.
+func emulateProfile(page context.Context, frames *frameTargets, p config.Profile) error {
+	tasks, err := profileTasks(page, p)
+	if err != nil {
+		return err
+	}
+
+	metrics := chromedp.Tasks{}
+	if p.Width != 0 || p.Height != 0 || p.DeviceScaleFactor != 0 || p.Mobile {
+		// Zero width, height or scale factor keeps the browser's value.
+		metrics = append(metrics, emulation.SetDeviceMetricsOverride(p.Width, p.Height, p.DeviceScaleFactor, p.Mobile))
+	}
+	if err := chromedp.Run(page, metrics, tasks); err != nil {
+		return fmt.Errorf("emulating profile: %w", err)
+	}
+
+	frames.onAttach(func(frameCtx context.Context) {
+		// The iframe may already be gone again, that's fine.
+		chromedp.Run(frameCtx, tasks)
+	})
+	return nil
+}
+
+// The emulation calls of the profile that apply to a single target, apart from the viewport.
+func profileTasks(ctx context.Context, p config.Profile) (chromedp.Tasks, error) {
+	tasks := chromedp.Tasks{}
+
+	if p.Touch {
+		configuration := emulation.SetEmitTouchEventsForMouseConfigurationDesktop
+		if p.Mobile {
+			configuration = emulation.SetEmitTouchEventsForMouseConfigurationMobile
+		}
+		tasks = append(tasks,
+			emulation.SetTouchEmulationEnabled(true).WithMaxTouchPoints(5),
+			// So that the clicks of `t.browser.click` are taps.
+			emulation.SetEmitTouchEventsForMouse(true).WithConfiguration(configuration),
+		)
+	}
+
+	if p.UserAgent != "" || p.Locale != "" {
+		userAgent := p.UserAgent
+		if userAgent == "" {
+			// The Accept-Language header and `navigator.languages` can only be changed along with the user agent.
+			// The tab context has no executor of its own, chromedp.Run provides it.
+			err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+				var err error
+				_, _, _, userAgent, _, err = browser.GetVersion().Do(ctx)
+				return err
+			}))
+			if err != nil {
+				return nil, fmt.Errorf("getting the user agent: %w", err)
+			}
+		}
+		ua := emulation.SetUserAgentOverride(userAgent)
+		if p.Locale != "" {
+			ua = ua.WithAcceptLanguage(p.Locale)
+		}
+		tasks = append(tasks, ua)
+	}
+
+	if p.Locale != "" {
+		tasks = append(tasks, emulation.SetLocaleOverride().WithLocale(p.Locale))
+	}
+
+	if p.Timezone != "" {
+		tasks = append(tasks, emulation.SetTimezoneOverride(p.Timezone))
+	}
+
+	if p.ColorScheme != "" {
+		tasks = append(tasks, emulation.SetEmulatedMedia().WithFeatures([]*emulation.MediaFeature{
+			{Name: "prefers-color-scheme", Value: p.ColorScheme},
+		}))
+	}
+
+	return tasks, nil
+}
@@ -0,0 +1,162 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventRunStart   EventType = "run_start"
+	EventTestStart  EventType = "test_start"
+	EventTestEnd    EventType = "test_end"
+	EventRunSummary EventType = "run_summary"
+)
+
+// A single line in the `--format json` output.
+type Event struct {
+	Type EventType `json:"event"`
+	Time time.Time `json:"time"`
+
+	// run_start
+	Tests       []string `json:"tests,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"`
+
+	// test_start
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+
+	// test_end
+	Result *EventTestResult `json:"result,omitempty"`
+
+	// run_summary
+	Summary *RunSummary `json:"summary,omitempty"`
+}
+
+type EventTestResult struct {
+	Name          string          `json:"name"`
+	Test          string          `json:"test"`
+	Variant       string          `json:"variant"`
+	Browser       string          `json:"browser"`
+	URL           string          `json:"url"`
+	Status        TestStatus      `json:"status"`
+	Message       string          `json:"message"`
+	Attempt       int             `json:"attempt"`
+	DurationMs    float64         `json:"durationMs"`
+	Timing        *EventTiming    `json:"timing"`
+	Warnings      []string        `json:"warnings,omitempty"`
+	InternalError string          `json:"internalError,omitempty"`
+	Subtests      []SubtestResult `json:"subtests"`
+	Logs          []LogEntry      `json:"logs"`
+	Network       *NetworkSummary `json:"network,omitempty"`
+	Artifacts     []string        `json:"artifacts,omitempty"`
+	// The earlier attempts that failed, if the test was retried.
+	FailedAttempts []*EventTestResult `json:"failedAttempts,omitempty"`
+}
+
+// Where the time of a test went, see TimingBreakdown.
+type EventTiming struct {
+	NewPageMs float64           `json:"newPageMs"`
+	LoadMs    float64           `json:"loadMs"`
+	SuiteMs   float64           `json:"suiteMs"`
+	Pages     []PageLoadTimings `json:"pages"`
+	Widgets   []WidgetTimings   `json:"widgets"`
+}
+
+type RunSummary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	Flaky   int `json:"flaky"`
+	// The failed tests that failed because of autotest (or the browser) rather than the test itself, e.g. because the
+	// page didn't load.
+	Errors     int     `json:"errors"`
+	DurationMs float64 `json:"durationMs"`
+	// Names of the tests that passed after failing.
+	FlakyTests []string `json:"flakyTests,omitempty"`
+	// Problems of autotest besides the tests themselves, e.g. a report that couldn't be written.
+	HarnessErrors []string `json:"harnessErrors,omitempty"`
+	// The exit code autotest exits with, see ExitTestsFailed and ExitHarnessError.
+	ExitCode int `json:"exitCode"`
+}
+
+// Writes newline-delimited JSON events, it is safe for concurrent use. A nil *eventWriter discards all events.
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (w *eventWriter) write(ev Event) {
+	if w == nil {
+		return
+	}
+	ev.Time = time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Encode appends the newline for us.
+	w.enc.Encode(ev)
+}
+
+func (w *eventWriter) runStart(testNames []string, concurrency int) {
+	w.write(Event{Type: EventRunStart, Tests: testNames, Concurrency: concurrency})
+}
+
+func (w *eventWriter) testStart(name string, url string) {
+	w.write(Event{Type: EventTestStart, Name: name, URL: url})
+}
+
+func (w *eventWriter) testEnd(tr *TestResult) {
+	w.write(Event{Type: EventTestEnd, Name: tr.Name, Result: eventTestResult(tr)})
+}
+
+func eventTestResult(tr *TestResult) *EventTestResult {
+	res := &EventTestResult{
+		Name:       tr.Name,
+		Test:       tr.Test,
+		Variant:    tr.Variant.String(),
+		Browser:    tr.Browser,
+		URL:        tr.URL,
+		Status:     tr.Status,
+		Message:    tr.Message,
+		Attempt:    tr.Attempt,
+		DurationMs: float64(tr.Timing) / float64(time.Millisecond),
+		Timing: &EventTiming{
+			NewPageMs: float64(tr.TimingBreakdown.NewPage) / float64(time.Millisecond),
+			LoadMs:    float64(tr.TimingBreakdown.Load) / float64(time.Millisecond),
+			SuiteMs:   float64(tr.TimingBreakdown.Suite) / float64(time.Millisecond),
+			Pages:     tr.TimingBreakdown.Pages,
+			Widgets:   tr.TimingBreakdown.Widgets,
+		},
+		Warnings:  tr.Warnings,
+		Subtests:  tr.Subtests,
+		Logs:      tr.Logs,
+		Network:   tr.Network,
+		Artifacts: tr.Artifacts,
+	}
+	if tr.InternalError != nil {
+		res.InternalError = tr.InternalError.Error()
+	}
+	for _, a := range tr.FailedAttempts {
+		res.FailedAttempts = append(res.FailedAttempts, eventTestResult(a))
+	}
+	return res
+}
+
+func (w *eventWriter) runSummary(s *RunSummary) {
+	w.write(Event{Type: EventRunSummary, Summary: s})
+}
@@ -0,0 +1,606 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	goruntime "runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/bidi"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/knadh/koanf/v2"
+)
+
+// Time we give Firefox to start and to quit.
+const firefoxTimeout = 30 * time.Second
+
+// Preferences of the Firefox profile we run with, after those of Puppeteer and geckodriver.
+const firefoxPrefs = `user_pref("browser.shell.checkDefaultBrowser", false);
+user_pref("browser.startup.homepage_override.mstone", "ignore");
+user_pref("browser.tabs.warnOnClose", false);
+user_pref("datareporting.policy.dataSubmissionEnabled", false);
+user_pref("toolkit.telemetry.reportingpolicy.firstRun", false);
+user_pref("dom.disable_open_during_load", false);
+user_pref("remote.prefs.recommended", true);
+`
+
+// Firefox prints this to stderr once its remote agent is listening.
+var firefoxListeningRe = regexp.MustCompile(`WebDriver BiDi listening on (ws://\S+)`)
+
+// The events we subscribe to, for all browsing contexts.
+var firefoxEvents = []string{
+	"browsingContext.contextCreated",
+	"browsingContext.contextDestroyed",
+	"log.entryAdded",
+	"network.beforeRequestSent",
+	"network.responseCompleted",
+	"network.fetchError",
+}
+
+// Drives a locally installed (or remote) Firefox through WebDriver BiDi. Unlike in Chromium, the page has no bridge to
+// request the trusted input of `t.browser` through (see bridge.go), so it is unavailable. Firefox also can't throttle the
+// network, and only emulates the viewport, timezone, locale and user agent of profiles.
+type firefoxBrowser struct {
+	// Nil if we connected to a remote browser.
+	cmd        *exec.Cmd
+	profileDir string
+	conn       *bidi.Conn
+
+	mu sync.Mutex
+	// The parent of every browsing context that is an iframe.
+	parents map[string]string
+	// The URL every browsing context last navigated to.
+	urls map[string]string
+	// The pages by their top-level browsing context.
+	pages map[string]*firefoxPage
+}
+
+// The Firefox executable on the PATH, or where it is installed by default on macOS.
+func findFirefox() (string, error) {
+	if path, err := exec.LookPath("firefox"); err == nil {
+		return path, nil
+	}
+	if goruntime.GOOS == "darwin" {
+		path := "/Applications/Firefox.app/Contents/MacOS/firefox"
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("firefox not found, set autotest.browser_exec_path")
+}
+
+// Launches Firefox, or connects to the WebDriver BiDi server at remoteURL if set.
+func newFirefoxBrowser(k *koanf.Koanf, remoteURL string) (Browser, error) {
+	b := &firefoxBrowser{
+		parents: make(map[string]string),
+		urls:    make(map[string]string),
+		pages:   make(map[string]*firefoxPage),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), firefoxTimeout)
+	defer cancel()
+
+	wsURL := remoteURL
+	if wsURL == "" {
+		var err error
+		if wsURL, err = b.launch(ctx, k); err != nil {
+			b.Close()
+			return nil, err
+		}
+	}
+
+	if err := b.connect(ctx, wsURL); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Starts Firefox with a fresh profile and returns the URL of its WebDriver BiDi server.
+func (b *firefoxBrowser) launch(ctx context.Context, k *koanf.Koanf) (string, error) {
+	execPath := k.String("autotest.browser_exec_path")
+	if execPath == "" {
+		var err error
+		if execPath, err = findFirefox(); err != nil {
+			return "", err
+		}
+	}
+
+	profileDir, err := os.MkdirTemp("", "sdktest-firefox-")
+	if err != nil {
+		return "", err
+	}
+	b.profileDir = profileDir
+	if err := os.WriteFile(filepath.Join(profileDir, "user.js"), []byte(firefoxPrefs), 0o644); err != nil {
+		return "", err
+	}
+
+	// A port of zero picks a free one, which Firefox prints.
+	args := []string{"--remote-debugging-port=0", "--profile", profileDir, "--no-remote", "--new-instance"}
+	if k.Bool("autotest.headless") {
+		args = append(args, "--headless")
+	}
+	cmd := exec.Command(execPath, append(args, "about:blank")...)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	b.cmd = cmd
+
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if m := firefoxListeningRe.FindStringSubmatch(scanner.Text()); m != nil {
+				found <- m[1]
+				break
+			}
+		}
+		// Firefox blocks once the pipe is full.
+		io.Copy(io.Discard, stderr)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", fmt.Errorf("waiting for the remote agent of firefox: %w", ctx.Err())
+	case wsURL := <-found:
+		return wsURL, nil
+	}
+}
+
+// Starts a WebDriver BiDi session, wsURL is that of the server, e.g. `ws://127.0.0.1:9222`.
+func (b *firefoxBrowser) connect(ctx context.Context, wsURL string) error {
+	conn, err := bidi.Dial(ctx, strings.TrimSuffix(wsURL, "/")+"/session")
+	if err != nil {
+		return fmt.Errorf("connecting to firefox: %w", err)
+	}
+	b.conn = conn
+	conn.OnEvent(b.handleEvent)
+
+	capabilities := map[string]any{"alwaysMatch": map[string]any{"acceptInsecureCerts": true}}
+	if err := conn.Call(ctx, "session.new", map[string]any{"capabilities": capabilities}, nil); err != nil {
+		return fmt.Errorf("starting a session: %w", err)
+	}
+	if err := conn.Call(ctx, "session.subscribe", map[string]any{"events": firefoxEvents}, nil); err != nil {
+		return fmt.Errorf("subscribing to events: %w", err)
+	}
+	return nil
+}
+
+func (b *firefoxBrowser) Name() string {
+	return "firefox"
+}
+
+func (b *firefoxBrowser) Close() {
+	if b.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), firefoxTimeout)
+		if b.cmd != nil {
+			b.conn.Call(ctx, "browser.close", nil, nil)
+		} else {
+			// Leave a remote browser running for whoever else uses it.
+			b.conn.Call(ctx, "session.end", nil, nil)
+		}
+		cancel()
+		b.conn.Close()
+	}
+
+	if b.profileDir != "" {
+		defer os.RemoveAll(b.profileDir)
+	}
+	if b.cmd == nil {
+		return
+	}
+	exited := make(chan struct{})
+	go func() {
+		b.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(firefoxTimeout):
+		b.cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// Routes an event to the page of the browsing context it happened in, see bidi_events.go.
+func (b *firefoxBrowser) handleEvent(ev bidi.Event) {
+	if ev.Method == "browsingContext.contextCreated" {
+		var info struct {
+			Context string  `json:"context"`
+			Parent  *string `json:"parent"`
+			URL     string  `json:"url"`
+		}
+		if json.Unmarshal(ev.Params, &info) != nil {
+			return
+		}
+		b.mu.Lock()
+		if info.Parent != nil {
+			b.parents[info.Context] = *info.Parent
+		}
+		b.urls[info.Context] = info.URL
+		b.mu.Unlock()
+		return
+	}
+	if ev.Method == "browsingContext.contextDestroyed" {
+		var info bidiContextInfo
+		if json.Unmarshal(ev.Params, &info) != nil {
+			return
+		}
+		b.mu.Lock()
+		b.forget(info)
+		b.mu.Unlock()
+		return
+	}
+
+	contextID := eventContext(ev)
+	if contextID == "" {
+		return
+	}
+
+	b.mu.Lock()
+	top := contextID
+	for {
+		parent, ok := b.parents[top]
+		if !ok {
+			break
+		}
+		top = parent
+	}
+	page := b.pages[top]
+	targetName := pageTargetName
+	if contextID != top {
+		targetName = b.urls[contextID]
+	}
+	b.mu.Unlock()
+
+	if page != nil {
+		page.handle(contextID, targetName, ev)
+	}
+}
+
+// The browsing context of a contextDestroyed event, along with its iframes.
+type bidiContextInfo struct {
+	Context  string            `json:"context"`
+	Children []bidiContextInfo `json:"children"`
+}
+
+// Forgets a browsing context that was destroyed and its iframes. The caller must hold b.mu.
+func (b *firefoxBrowser) forget(info bidiContextInfo) {
+	delete(b.parents, info.Context)
+	delete(b.urls, info.Context)
+	for _, child := range info.Children {
+		b.forget(child)
+	}
+}
+
+// Remembers the URL a browsing context navigates to, iframes are named by it.
+func (b *firefoxBrowser) navigated(contextID string, url string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.urls[contextID] = url
+}
+
+type firefoxPage struct {
+	browser *firefoxBrowser
+	// The top-level browsing context (the tab).
+	context string
+	// The user context the tab was opened in, empty for the default one that is shared by all tests.
+	userContext string
+
+	logs     *logCollector
+	requests *networkRecorder
+	// Redirect responses by request ID, they are reported along with the request they redirect to.
+	redirects map[string]*bidiResponse
+
+	network config.Network
+	// Done when the page is closed, which stops the scheduled network condition changes.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (b *firefoxBrowser) NewPage(run testRun, conf config.Config, logs *logCollector, requests *networkRecorder) (Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), firefoxTimeout)
+	defer cancel()
+
+	create := map[string]any{"type": "tab"}
+	var userContext string
+	if !conf.SharedBrowserContext {
+		// A fresh user context (Firefox' name for a browser context) keeps cookies, storage and cache from leaking
+		// between tests, it is removed along with the tab.
+		var created struct {
+			UserContext string `json:"userContext"`
+		}
+		if err := b.conn.Call(ctx, "browser.createUserContext", nil, &created); err != nil {
+			return nil, &stepError{"creating a browser context", err}
+		}
+		userContext = created.UserContext
+		create["userContext"] = userContext
+	}
+
+	var created struct {
+		Context string `json:"context"`
+	}
+	if err := b.conn.Call(ctx, "browsingContext.create", create, &created); err != nil {
+		if userContext != "" {
+			b.conn.Call(ctx, "browser.removeUserContext", map[string]any{"userContext": userContext}, nil)
+		}
+		return nil, &stepError{"opening a new tab", err}
+	}
+
+	p := &firefoxPage{
+		browser:     b,
+		context:     created.Context,
+		userContext: userContext,
+		logs:        logs,
+		requests:    requests,
+		redirects:   make(map[string]*bidiResponse),
+		network:     conf.Network,
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	b.mu.Lock()
+	b.pages[p.context] = p
+	b.mu.Unlock()
+
+	if run.Variant.Profile != "" {
+		profile, ok := conf.Profiles[run.Variant.Profile]
+		if !ok {
+			p.Close()
+			return nil, &stepError{"loading the emulation profile", fmt.Errorf("emulation profile %q isn't defined under profiles", run.Variant.Profile)}
+		}
+		if err := p.emulateProfile(ctx, profile); err != nil {
+			p.Close()
+			return nil, &stepError{"emulating the device", err}
+		}
+	}
+
+	return p, nil
+}
+
+func (p *firefoxPage) call(ctx context.Context, method string, params any, result any) error {
+	return p.browser.conn.Call(ctx, method, params, result)
+}
+
+// Records a warning for the parts of the test config Firefox can't emulate, so it's clear why a test behaves as if
+// they weren't set.
+func (p *firefoxPage) unsupported(what string) {
+	p.logs.add(LogEntry{
+		Time:   time.Now(),
+		Source: LogSourceBrowser,
+		Level:  "warning",
+		Text:   fmt.Sprintf("autotest can't emulate %s in firefox, it is ignored", what),
+		Target: pageTargetName,
+	})
+}
+
+func (p *firefoxPage) emulateProfile(ctx context.Context, profile config.Profile) error {
+	contexts := []string{p.context}
+
+	if profile.Width != 0 || profile.Height != 0 || profile.DeviceScaleFactor != 0 {
+		params := map[string]any{"context": p.context}
+		if profile.Width != 0 && profile.Height != 0 {
+			params["viewport"] = map[string]any{"width": profile.Width, "height": profile.Height}
+		}
+		if profile.DeviceScaleFactor != 0 {
+			params["devicePixelRatio"] = profile.DeviceScaleFactor
+		}
+		if err := p.call(ctx, "browsingContext.setViewport", params, nil); err != nil {
+			return fmt.Errorf("setting the viewport: %w", err)
+		}
+	}
+	if profile.Timezone != "" {
+		params := map[string]any{"timezone": profile.Timezone, "contexts": contexts}
+		if err := p.call(ctx, "emulation.setTimezoneOverride", params, nil); err != nil {
+			return fmt.Errorf("setting the timezone: %w", err)
+		}
+	}
+	if profile.Locale != "" {
+		params := map[string]any{"locale": profile.Locale, "contexts": contexts}
+		if err := p.call(ctx, "emulation.setLocaleOverride", params, nil); err != nil {
+			return fmt.Errorf("setting the locale: %w", err)
+		}
+	}
+	if profile.UserAgent != "" {
+		params := map[string]any{"userAgent": profile.UserAgent, "contexts": contexts}
+		if err := p.call(ctx, "emulation.setUserAgentOverride", params, nil); err != nil {
+			return fmt.Errorf("setting the user agent: %w", err)
+		}
+	}
+
+	if profile.Mobile {
+		p.unsupported("a mobile device")
+	}
+	if profile.Touch {
+		p.unsupported("touch")
+	}
+	if profile.ColorScheme != "" {
+		p.unsupported("prefers-color-scheme")
+	}
+	return nil
+}
+
+// Firefox can only take the page offline, throttling is ignored.
+func (p *firefoxPage) setNetworkConditions(ctx context.Context, c config.NetworkConditions) error {
+	if c.Latency != 0 || c.DownloadThroughput != 0 || c.UploadThroughput != 0 {
+		p.unsupported("network throttling")
+	}
+
+	var conditions any // null stops emulating
+	if c.Offline {
+		conditions = map[string]any{"type": "offline"}
+	}
+	return p.call(ctx, "emulation.setNetworkConditions", map[string]any{
+		"networkConditions": conditions,
+		"contexts":          []string{p.context},
+	}, nil)
+}
+
+// Applies the initial network conditions of the test config and schedules its changes, relative to now.
+func (p *firefoxPage) startNetworkConditions(ctx context.Context) error {
+	if p.network.IsZero() {
+		return nil
+	}
+
+	if !p.network.NetworkConditions.IsZero() {
+		if err := p.setNetworkConditions(ctx, p.network.NetworkConditions); err != nil {
+			return err
+		}
+	}
+
+	for _, change := range p.network.Changes {
+		go func(change config.NetworkChange) {
+			select {
+			case <-p.ctx.Done():
+			case <-time.After(change.After):
+				p.setNetworkConditions(p.ctx, change.NetworkConditions)
+			}
+		}(change)
+	}
+	return nil
+}
+
+// Polls until an element matches the selector.
+func (p *firefoxPage) waitReady(ctx context.Context, selector string) error {
+	for {
+		var ready bool
+		if err := p.Evaluate(ctx, fmt.Sprintf("!!document.querySelector(%s)", jsString(selector)), &ready); err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (p *firefoxPage) Open(ctx context.Context, url string) error {
+	if err := p.startNetworkConditions(ctx); err != nil {
+		return &stepError{"emulating network conditions", err}
+	}
+	return p.Navigate(ctx, url)
+}
+
+func (p *firefoxPage) Navigate(ctx context.Context, url string) error {
+	params := map[string]any{"context": p.context, "url": url, "wait": "complete"}
+	if err := p.call(ctx, "browsingContext.navigate", params, nil); err != nil {
+		return &stepError{"waiting for browser to open page", err}
+	}
+	return p.waitSuiteReady(ctx)
+}
+
+func (p *firefoxPage) Reload(ctx context.Context) error {
+	params := map[string]any{"context": p.context, "wait": "complete"}
+	if err := p.call(ctx, "browsingContext.reload", params, nil); err != nil {
+		return &stepError{"waiting for browser to reload page", err}
+	}
+	return p.waitSuiteReady(ctx)
+}
+
+// Waits for the test suite of the page that was just loaded to be ready to start.
+func (p *firefoxPage) waitSuiteReady(ctx context.Context) error {
+	if err := p.waitReady(ctx, "body"); err != nil {
+		return &stepError{"waiting for body", err}
+	}
+
+	if err := p.waitReady(ctx, ".sdktest-start"); err != nil {
+		return &stepError{"waiting to start", err}
+	}
+
+	// We click so that the browser is focused, otherwise the focus event doesn't work in some cases for form elements.
+	p.call(ctx, "input.performActions", map[string]any{
+		"context": p.context,
+		"actions": []any{map[string]any{
+			"type":       "pointer",
+			"id":         "mouse",
+			"parameters": map[string]any{"pointerType": "mouse"},
+			"actions": []any{
+				map[string]any{"type": "pointerMove", "x": 0, "y": 0},
+				map[string]any{"type": "pointerDown", "button": 0},
+				map[string]any{"type": "pointerUp", "button": 0},
+			},
+		}},
+	}, nil)
+	return nil
+}
+
+func (p *firefoxPage) Evaluate(ctx context.Context, expression string, res any) error {
+	// BiDi serializes values in a format of its own, it's easier to let the page give us JSON.
+	var result struct {
+		// "success" or "exception"
+		Type   string `json:"type"`
+		Result struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"result"`
+		ExceptionDetails struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	err := p.call(ctx, "script.evaluate", map[string]any{
+		"expression":      fmt.Sprintf("(async () => JSON.stringify(await (%s)))()", expression),
+		"target":          map[string]any{"context": p.context},
+		"awaitPromise":    true,
+		"resultOwnership": "none",
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if result.Type == "exception" {
+		return fmt.Errorf("evaluating %q: %s", expression, result.ExceptionDetails.Text)
+	}
+
+	// JSON.stringify(undefined) is undefined.
+	if res == nil || result.Result.Type != "string" {
+		return nil
+	}
+	return json.Unmarshal([]byte(result.Result.Value), res)
+}
+
+func (p *firefoxPage) Screenshot(ctx context.Context) ([]byte, error) {
+	var result struct {
+		Data string `json:"data"`
+	}
+	params := map[string]any{"context": p.context, "origin": "document"}
+	if err := p.call(ctx, "browsingContext.captureScreenshot", params, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Data)
+}
+
+func (p *firefoxPage) Close() {
+	p.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), firefoxTimeout)
+	defer cancel()
+	p.call(ctx, "browsingContext.close", map[string]any{"context": p.context}, nil)
+	if p.userContext != "" {
+		p.call(ctx, "browser.removeUserContext", map[string]any{"userContext": p.userContext}, nil)
+	}
+
+	p.browser.mu.Lock()
+	delete(p.browser.pages, p.context)
+	p.browser.mu.Unlock()
+}
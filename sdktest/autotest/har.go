@@ -0,0 +1,222 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// The subset of HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/) that we can fill from the CDP Network domain.
+// Response bodies are not included.
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Pages   []harPage  `json:"pages"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harPage struct {
+	StartedDateTime time.Time      `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     map[string]any `json:"pageTimings"`
+}
+
+type harEntry struct {
+	PageRef         string         `json:"pageref"`
+	StartedDateTime time.Time      `json:"startedDateTime"`
+	Time            float64        `json:"time"`
+	Request         harRequest     `json:"request"`
+	Response        harResponse    `json:"response"`
+	Cache           map[string]any `json:"cache"`
+	Timings         harTimings     `json:"timings"`
+
+	// Custom fields, prefixed with an underscore as per the spec.
+	RequestID    string `json:"_requestId"`
+	ResourceType string `json:"_resourceType"`
+	Target       string `json:"_target"`
+	FrameID      string `json:"_frameId,omitempty"`
+	Error        string `json:"_error,omitempty"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int64          `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    float64        `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     float64 `json:"size"`
+	MimeType string  `json:"mimeType"`
+}
+
+// In milliseconds, -1 if not applicable.
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func harHeaders(headers network.Headers) []harNameValue {
+	values := make([]harNameValue, 0, len(headers))
+	for name, v := range headers {
+		values = append(values, harNameValue{Name: name, Value: fmt.Sprint(v)})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+func harQueryString(rawURL string) []harNameValue {
+	values := make([]harNameValue, 0)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return values
+	}
+	for name, vs := range u.Query() {
+		for _, v := range vs {
+			values = append(values, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+// Milliseconds between two offsets of the resource timing, -1 if either is missing.
+func harSpan(start, end float64) float64 {
+	if start < 0 || end < 0 {
+		return -1
+	}
+	return end - start
+}
+
+func harTimingsFor(req *networkRequest) harTimings {
+	total := float64(req.duration()) / float64(time.Millisecond)
+	t := harTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Send: 0, Wait: total, Receive: 0}
+	if req.response == nil || req.response.Timing == nil {
+		return t
+	}
+
+	rt := req.response.Timing
+	t.DNS = harSpan(rt.DNSStart, rt.DNSEnd)
+	t.Connect = harSpan(rt.ConnectStart, rt.ConnectEnd)
+	t.SSL = harSpan(rt.SslStart, rt.SslEnd)
+	t.Send = max(0, harSpan(rt.SendStart, rt.SendEnd))
+	t.Wait = max(0, harSpan(rt.SendEnd, rt.ReceiveHeadersEnd))
+	t.Receive = max(0, total-rt.ReceiveHeadersEnd)
+	return t
+}
+
+func harEntryFor(req *networkRequest) harEntry {
+	e := harEntry{
+		PageRef:         pageTargetName,
+		StartedDateTime: req.started,
+		Time:            float64(req.duration()) / float64(time.Millisecond),
+		Request: harRequest{
+			Method:      req.request.Method,
+			URL:         req.request.URL,
+			HTTPVersion: "",
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(req.request.Headers),
+			QueryString: harQueryString(req.request.URL),
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			RedirectURL: req.redirectURL,
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Cache:        map[string]any{},
+		Timings:      harTimingsFor(req),
+		RequestID:    string(req.id),
+		ResourceType: string(req.resourceType),
+		Target:       req.target,
+		FrameID:      string(req.frameID),
+		Error:        req.error(),
+	}
+
+	if res := req.response; res != nil {
+		e.Request.HTTPVersion = res.Protocol
+		if len(res.RequestHeaders) > 0 {
+			// The headers that were actually sent, including cookies and the like.
+			e.Request.Headers = harHeaders(res.RequestHeaders)
+		}
+		e.Response.Status = res.Status
+		e.Response.StatusText = res.StatusText
+		e.Response.HTTPVersion = res.Protocol
+		e.Response.Headers = harHeaders(res.Headers)
+		e.Response.Content = harContent{Size: req.encodedDataLength, MimeType: res.MimeType}
+		e.Response.BodySize = req.encodedDataLength
+	}
+	return e
+}
+
+// Serializes the recorded requests as a HAR file, which can be imported in the network panel of the browser devtools.
+func (n *networkRecorder) HAR(testURL string, started time.Time) ([]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	har := harFile{
+		Log: harLog{
+			Version: "1.2",
+			Creator: harCreator{Name: "sdktest", Version: "1.0"},
+			Pages: []harPage{{
+				StartedDateTime: started,
+				ID:              pageTargetName,
+				Title:           testURL,
+				PageTimings:     map[string]any{},
+			}},
+			Entries: make([]harEntry, 0, len(n.requests)),
+		},
+	}
+	for _, req := range n.requests {
+		har.Log.Entries = append(har.Log.Entries, harEntryFor(req))
+	}
+
+	return json.MarshalIndent(har, "", "  ")
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"time"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/history"
+)
+
+// The record of the test in the history, with the timings of its slowest widget.
+func historyTest(tr *TestResult) history.Test {
+	t := history.Test{
+		Name:       tr.Name,
+		Status:     string(tr.Status),
+		DurationMs: float64(tr.Timing) / float64(time.Millisecond),
+		LoadMs:     float64(tr.TimingBreakdown.Load) / float64(time.Millisecond),
+	}
+	for _, w := range tr.TimingBreakdown.Widgets {
+		if ready, ok := w.at("unactivated"); ok {
+			t.WidgetReadyMs = max(t.WidgetReadyMs, float64(ready)/float64(time.Millisecond))
+		}
+		if completed, ok := w.between("activating", "completed"); ok {
+			t.WidgetCompletedMs = max(t.WidgetCompletedMs, float64(completed)/float64(time.Millisecond))
+		}
+	}
+	return t
+}
+
+// Appends the run to the history in `autotest.history_dir`, for `sdktest history` to compare against.
+func appendHistory(dir string, browser string, results []*TestResult, started time.Time) error {
+	run := history.Run{
+		ID:         history.NewRunID(started),
+		Started:    started,
+		DurationMs: float64(time.Since(started)) / float64(time.Millisecond),
+		Commit:     history.CurrentCommit(),
+		Browser:    browser,
+		Tests:      make([]history.Test, 0, len(results)),
+	}
+	for _, tr := range results {
+		run.Tests = append(run.Tests, historyTest(tr))
+	}
+	return history.Append(dir, run)
+}
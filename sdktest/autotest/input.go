@@ -0,0 +1,176 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+	"github.com/chromedp/chromedp/kb"
+)
+
+// Time an input request may take, this includes waiting for the element to exist.
+const inputTimeout = 10 * time.Second
+
+type point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Scrolls the element into view and returns the center of it, relative to the viewport of its document.
+const elementCenterScript = `((doc, selector) => {
+	const el = doc && doc.querySelector(selector);
+	if (!el) {
+		return null;
+	}
+	el.scrollIntoView({ block: "center", inline: "center" });
+	const r = el.getBoundingClientRect();
+	return { x: r.left + r.width / 2, y: r.top + r.height / 2 };
+})(%s, %s)`
+
+// Returns the position of the content box of an iframe, relative to the viewport of the test page.
+const frameOffsetScript = `((selector) => {
+	const f = document.querySelector(selector);
+	if (!f) {
+		return null;
+	}
+	const r = f.getBoundingClientRect();
+	return { x: r.left + f.clientLeft, y: r.top + f.clientTop };
+})(%s)`
+
+// The keys that can be pressed by name.
+var namedKeys = map[string]string{
+	"Enter":      kb.Enter,
+	"Tab":        kb.Tab,
+	"Escape":     kb.Escape,
+	"Backspace":  kb.Backspace,
+	"Delete":     kb.Delete,
+	"Space":      " ",
+	"ArrowDown":  kb.ArrowDown,
+	"ArrowLeft":  kb.ArrowLeft,
+	"ArrowRight": kb.ArrowRight,
+	"ArrowUp":    kb.ArrowUp,
+	"Home":       kb.Home,
+	"End":        kb.End,
+}
+
+// Dispatches a trusted click on the center of the element, see locate.
+func (b *browserBridge) click(ctx context.Context, selector string, frame string) error {
+	p, err := b.locate(ctx, selector, frame)
+	if err != nil {
+		return err
+	}
+	return chromedp.Run(ctx, chromedp.MouseClickXY(p.X, p.Y))
+}
+
+// Presses a key by name in the focused element.
+func (b *browserBridge) press(ctx context.Context, name string) error {
+	key, ok := namedKeys[name]
+	if !ok {
+		return fmt.Errorf("unknown key %q", name)
+	}
+	return chromedp.Run(ctx, chromedp.KeyEvent(key))
+}
+
+// Returns the center of the element relative to the viewport of the test page, which is where we need to click.
+func (b *browserBridge) locate(ctx context.Context, selector string, frame string) (point, error) {
+	if frame == "" {
+		return b.elementCenter(ctx, b.page, "document", selector)
+	}
+
+	if err := chromedp.Run(ctx, chromedp.WaitReady(frame, chromedp.ByQuery)); err != nil {
+		return point{}, fmt.Errorf("waiting for iframe %q: %w", frame, err)
+	}
+
+	// Same-origin iframes can be reached from the test page, cross-origin ones have a target of their own.
+	frameDoc := fmt.Sprintf("document.querySelector(%s).contentDocument", jsString(frame))
+	var sameOrigin bool
+	if err := chromedp.Run(ctx, chromedp.Evaluate("!!"+frameDoc, &sameOrigin)); err != nil {
+		return point{}, err
+	}
+
+	var inner point
+	var err error
+	if sameOrigin {
+		inner, err = b.elementCenter(ctx, b.page, frameDoc, selector)
+	} else {
+		var frameCtx context.Context
+		frameCtx, err = b.frameContext(ctx, frame)
+		if err != nil {
+			return point{}, err
+		}
+		inner, err = b.elementCenter(ctx, frameCtx, "document", selector)
+	}
+	if err != nil {
+		return point{}, err
+	}
+
+	var offset *point
+	if err := chromedp.Run(ctx, chromedp.Evaluate(fmt.Sprintf(frameOffsetScript, jsString(frame)), &offset)); err != nil {
+		return point{}, err
+	}
+	if offset == nil {
+		return point{}, fmt.Errorf("no iframe matches %q", frame)
+	}
+	return point{X: offset.X + inner.X, Y: offset.Y + inner.Y}, nil
+}
+
+// Waits for the element to exist in the document and returns its center.
+func (b *browserBridge) elementCenter(ctx context.Context, docCtx context.Context, doc string, selector string) (point, error) {
+	for {
+		var p *point
+		// The deadline of ctx also applies to the (frame) document.
+		evalCtx, cancel := context.WithDeadline(docCtx, deadline(ctx))
+		err := chromedp.Run(evalCtx, chromedp.Evaluate(fmt.Sprintf(elementCenterScript, doc, jsString(selector)), &p))
+		cancel()
+		if err != nil {
+			return point{}, err
+		}
+		if p != nil {
+			return *p, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return point{}, fmt.Errorf("no element matches %q", selector)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Returns the chromedp context of the out-of-process iframe that matches the selector.
+func (b *browserBridge) frameContext(ctx context.Context, frame string) (context.Context, error) {
+	var nodes []*cdp.Node
+	if err := chromedp.Run(ctx, chromedp.Nodes(frame, &nodes, chromedp.ByQuery)); err != nil {
+		return nil, fmt.Errorf("finding iframe %q: %w", frame, err)
+	}
+	if nodes[0].FrameID == "" {
+		return nil, fmt.Errorf("%q is not an iframe", frame)
+	}
+
+	frameCtx, ok := b.frames.context(ctx, target.ID(nodes[0].FrameID))
+	if !ok {
+		return nil, fmt.Errorf("timed out attaching to iframe %q", frame)
+	}
+	return frameCtx, nil
+}
+
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func deadline(ctx context.Context) time.Time {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return time.Now().Add(inputTimeout)
+	}
+	return d
+}
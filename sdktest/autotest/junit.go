@@ -0,0 +1,226 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+	// The URL of the test page, handy when running with `--serve`, followed by the artifacts and warnings of the test.
+	SystemOut string `xml:"system-out,omitempty"`
+	// The console output of the test page and its iframes.
+	SystemErr string `xml:"system-err,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	// Failures of earlier attempts of a retried test, as flaky failures if the case passed in the end and otherwise as
+	// rerun failures (the Maven Surefire extension that most CI systems understand).
+	FlakyFailures []junitMessage `xml:"flakyFailure,omitempty"`
+	RerunFailures []junitMessage `xml:"rerunFailure,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func junitFailure(st SubtestResult) *junitMessage {
+	errType := ""
+	if len(st.RawErrors) > 0 {
+		errType = st.RawErrors[0].ErrorType
+	}
+	return &junitMessage{
+		Message: strings.Join(st.Errors, "\n"),
+		Type:    errType,
+		Body:    st.Stack(),
+	}
+}
+
+// The message of a test page that didn't run to completion.
+func junitInternalError(tr *TestResult) string {
+	if tr.InternalError != nil {
+		return fmt.Sprintf("%s: %v", tr.Message, tr.InternalError)
+	}
+	return tr.Message
+}
+
+// Adds the failures of the earlier attempts to the case, where a case of the suite itself stands for failures of the
+// attempts that didn't run to completion.
+func (tc *junitTestCase) addFailedAttempts(suite string, attempts []*TestResult) {
+	for _, a := range attempts {
+		var failure *junitMessage
+		if tc.Name == suite {
+			if a.InternalError != nil || len(a.Subtests) == 0 {
+				failure = &junitMessage{Message: junitInternalError(a), Type: "autotest"}
+			}
+		} else {
+			for _, st := range a.Subtests {
+				if st.Name == tc.Name && st.Status == TestStatusFail {
+					failure = junitFailure(st)
+				}
+			}
+		}
+		if failure == nil {
+			continue
+		}
+
+		failure.Message = fmt.Sprintf("attempt %d: %s", a.Attempt, failure.Message)
+		if tc.Failure != nil || tc.Error != nil {
+			tc.RerunFailures = append(tc.RerunFailures, *failure)
+		} else {
+			tc.FlakyFailures = append(tc.FlakyFailures, *failure)
+		}
+	}
+}
+
+func junitCase(suite string, st SubtestResult) junitTestCase {
+	tc := junitTestCase{
+		Name:      st.Name,
+		ClassName: suite,
+		Time:      junitSeconds(st.Timing()),
+	}
+
+	switch st.Status {
+	case TestStatusPass:
+	case TestStatusSkip:
+		tc.Skipped = &junitMessage{}
+	case TestStatusFail:
+		tc.Failure = junitFailure(st)
+	default: // The test never finished
+		tc.Error = &junitMessage{
+			Message: fmt.Sprintf("test ended in status %q", st.Status),
+		}
+	}
+	return tc
+}
+
+func junitSuite(tr *TestResult) junitTestSuite {
+	suite := junitTestSuite{
+		Name:      tr.Name,
+		Time:      junitSeconds(tr.Timing),
+		SystemOut: tr.URL,
+	}
+	// The attachment syntax is understood by the Jenkins and GitLab JUnit integrations.
+	for _, path := range tr.Artifacts {
+		suite.SystemOut += fmt.Sprintf("\n[[ATTACHMENT|%s]]", path)
+	}
+	for _, w := range tr.Warnings {
+		suite.SystemOut += "\nwarning: " + w
+	}
+	logs := make([]string, 0, len(tr.Logs))
+	for _, e := range tr.Logs {
+		logs = append(logs, e.String())
+	}
+	suite.SystemErr = strings.Join(logs, "\n")
+
+	for _, st := range tr.Subtests {
+		suite.Cases = append(suite.Cases, junitCase(tr.Name, st))
+	}
+
+	// The suite didn't run to completion (e.g. a timeout or browser error), we report that as a test case of its own.
+	passed := tr.Status == TestStatusPass || tr.Status == TestStatusSkip || tr.Status == TestStatusFlaky
+	if tr.InternalError != nil || (len(tr.Subtests) == 0 && !passed) {
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      tr.Name,
+			ClassName: tr.Name,
+			Time:      junitSeconds(tr.Timing),
+			Error:     &junitMessage{Message: junitInternalError(tr), Type: "autotest"},
+		})
+	} else if hasInternalError(tr.FailedAttempts) {
+		// A flaky test whose earlier attempts didn't run to completion.
+		suite.Cases = append(suite.Cases, junitTestCase{
+			Name:      tr.Name,
+			ClassName: tr.Name,
+			Time:      junitSeconds(tr.Timing),
+		})
+	}
+
+	for i := range suite.Cases {
+		suite.Cases[i].addFailedAttempts(tr.Name, tr.FailedAttempts)
+	}
+
+	for _, tc := range suite.Cases {
+		suite.Tests++
+		if tc.Failure != nil {
+			suite.Failures++
+		} else if tc.Error != nil {
+			suite.Errors++
+		} else if tc.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	return suite
+}
+
+func hasInternalError(attempts []*TestResult) bool {
+	for _, a := range attempts {
+		if a.InternalError != nil || len(a.Subtests) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes a JUnit XML report with a testsuite per test folder and a testcase per `sdktest.test(...)`.
+func writeJUnitReport(path string, results []*TestResult, timing time.Duration) error {
+	sorted := make([]*TestResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	report := junitTestSuites{
+		Name: "sdktest",
+		Time: junitSeconds(timing),
+	}
+	for _, tr := range sorted {
+		suite := junitSuite(tr)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, suite)
+	}
+
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append([]byte(xml.Header), out...), 0o644)
+}
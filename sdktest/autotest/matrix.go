@@ -0,0 +1,150 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/knadh/koanf/v2"
+)
+
+// Variant of the SDK bundles a test runs with, these map to the `?compat` and `?min` query flags of the test pages.
+type Variant struct {
+	Compat bool
+	Min    bool
+	// Name of the emulation profile, empty for none. Passed to the test page as `?profile=<name>`.
+	Profile string
+}
+
+// Parses a matrix entry: `plain`, `compat`, `min` or `compat+min`.
+func parseVariant(s string) (Variant, error) {
+	var v Variant
+	if s == "plain" {
+		return v, nil
+	}
+	for _, flag := range strings.Split(s, "+") {
+		switch strings.TrimSpace(flag) {
+		case "compat":
+			v.Compat = true
+		case "min":
+			v.Min = true
+		default:
+			return v, fmt.Errorf("unknown matrix variant %q, expected plain, compat, min or compat+min", s)
+		}
+	}
+	return v, nil
+}
+
+func (v Variant) flags() []string {
+	flags := make([]string, 0, 2)
+	if v.Compat {
+		flags = append(flags, "compat")
+	}
+	if v.Min {
+		flags = append(flags, "min")
+	}
+	return flags
+}
+
+// The query parameters of the test page.
+func (v Variant) query() []string {
+	query := v.flags()
+	if v.Profile != "" {
+		query = append(query, "profile="+url.QueryEscape(v.Profile))
+	}
+	return query
+}
+
+// The matrix entry, e.g. `compat+min`, followed by the profile if any, e.g. `plain@mobile`.
+func (v Variant) String() string {
+	s := "plain"
+	if v.Compat || v.Min {
+		s = strings.Join(v.flags(), "+")
+	}
+	if v.Profile != "" {
+		s += "@" + v.Profile
+	}
+	return s
+}
+
+// The name under which the test is reported, e.g. `csp[compat,min,mobile]`, or just `csp` for the plain variant.
+func (v Variant) testName(name string) string {
+	parts := v.flags()
+	if v.Profile != "" {
+		parts = append(parts, v.Profile)
+	}
+	if len(parts) == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s[%s]", name, strings.Join(parts, ","))
+}
+
+// The variants every test runs with, from `autotest.matrix` times `autotest.profiles`. Defaults to only the plain
+// variant without emulation.
+func getMatrix(k *koanf.Koanf) []Variant {
+	entries := k.Strings("autotest.matrix")
+	if len(entries) == 0 {
+		entries = []string{"plain"}
+	}
+
+	bundles := make([]Variant, 0, len(entries))
+	for _, e := range entries {
+		v, err := parseVariant(e)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		// `compat+min` and `min+compat` are the same variant
+		if !slices.Contains(bundles, v) {
+			bundles = append(bundles, v)
+		}
+	}
+
+	var profiles []string
+	for _, p := range k.Strings("autotest.profiles") {
+		if !k.Exists("profiles." + p) {
+			fatalf("Unknown emulation profile %q in autotest.profiles, it isn't defined under profiles", p)
+		}
+		if !slices.Contains(profiles, p) {
+			profiles = append(profiles, p)
+		}
+	}
+	return withProfiles(bundles, profiles)
+}
+
+// The bundle variants of the matrix, each with every profile. No profiles keeps the variants as is.
+func withProfiles(matrix []Variant, profiles []string) []Variant {
+	if len(profiles) == 0 {
+		return matrix
+	}
+
+	variants := make([]Variant, 0, len(matrix)*len(profiles))
+	for _, v := range matrix {
+		for _, p := range profiles {
+			v.Profile = p
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+// The variants a test runs with, tests that set `emulate` in their config.yaml pick their own profiles.
+func testMatrix(matrix []Variant, conf config.Config) []Variant {
+	if len(conf.Emulate) == 0 {
+		return matrix
+	}
+
+	var bundles []Variant
+	for _, v := range matrix {
+		v.Profile = ""
+		if !slices.Contains(bundles, v) {
+			bundles = append(bundles, v)
+		}
+	}
+	return withProfiles(bundles, conf.Emulate)
+}
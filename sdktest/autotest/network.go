@@ -0,0 +1,216 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/requestlog"
+)
+
+// Summary of the requests a test page and its iframes made.
+type NetworkSummary struct {
+	Requests int `json:"requests"`
+	// Origins that were contacted, e.g. `https://global.frcapi.com`, sorted.
+	Origins []string `json:"origins"`
+	// Requests that failed to load (e.g. blocked by CSP) or got an HTTP error status.
+	Failed []FailedRequest `json:"failed"`
+}
+
+type FailedRequest struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	// HTTP status code, zero if there was no response.
+	Status int64 `json:"status,omitempty"`
+	// e.g. `net::ERR_BLOCKED_BY_CLIENT`, or the reason it was blocked such as `csp`.
+	Error string `json:"error,omitempty"`
+}
+
+func (f FailedRequest) String() string {
+	if f.Error != "" {
+		return fmt.Sprintf("%s %s %s", f.Method, f.URL, f.Error)
+	}
+	return fmt.Sprintf("%s %s %d", f.Method, f.URL, f.Status)
+}
+
+// A request as seen through the CDP Network domain. A redirect starts a new request with the same ID.
+type networkRequest struct {
+	id           network.RequestID
+	target       string
+	frameID      cdp.FrameID
+	resourceType network.ResourceType
+
+	started   time.Time
+	startMono *cdp.MonotonicTime
+	endMono   *cdp.MonotonicTime
+
+	request  *network.Request
+	response *network.Response
+	// Set when the request was redirected.
+	redirectURL string
+
+	encodedDataLength float64
+	errorText         string
+	blockedReason     network.BlockedReason
+}
+
+// The error text of a request that failed to load, including the reason it was blocked if it was.
+func (r *networkRequest) error() string {
+	if r.blockedReason != "" {
+		return fmt.Sprintf("%s (blocked: %s)", r.errorText, r.blockedReason)
+	}
+	return r.errorText
+}
+
+func (r *networkRequest) failed() bool {
+	return r.errorText != "" || (r.response != nil && r.response.Status >= 400)
+}
+
+// Duration from sending the request until it finished, failed or got redirected.
+func (r *networkRequest) duration() time.Duration {
+	if r.startMono == nil || r.endMono == nil {
+		return 0
+	}
+	return r.endMono.Time().Sub(r.startMono.Time())
+}
+
+// Records the requests made by a test page and all of its iframes, including the navigations of the iframes.
+type networkRecorder struct {
+	mu       sync.Mutex
+	requests []*networkRequest
+	// Requests that are still in flight by ID.
+	pending map[network.RequestID]*networkRequest
+}
+
+func newNetworkRecorder() *networkRecorder {
+	return &networkRecorder{
+		pending: make(map[network.RequestID]*networkRequest),
+	}
+}
+
+// Handles the events of the page or iframe with given name, see listenPageAndFrames.
+func (n *networkRecorder) handle(targetName string, ev any) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch ev := ev.(type) {
+	case *network.EventRequestWillBeSent:
+		if prev, ok := n.pending[ev.RequestID]; ok {
+			if ev.RedirectResponse == nil {
+				// The navigation of an out-of-process iframe is reported by both its parent and itself.
+				return
+			}
+			prev.response = ev.RedirectResponse
+			prev.redirectURL = ev.Request.URL
+			prev.endMono = ev.Timestamp
+		}
+
+		req := &networkRequest{
+			id:           ev.RequestID,
+			target:       targetName,
+			frameID:      ev.FrameID,
+			resourceType: ev.Type,
+			startMono:    ev.Timestamp,
+			request:      ev.Request,
+		}
+		if ev.WallTime != nil {
+			req.started = ev.WallTime.Time()
+		}
+		n.pending[ev.RequestID] = req
+		n.requests = append(n.requests, req)
+	case *network.EventResponseReceived:
+		if req, ok := n.pending[ev.RequestID]; ok {
+			req.response = ev.Response
+		}
+	case *network.EventLoadingFinished:
+		if req, ok := n.pending[ev.RequestID]; ok {
+			req.encodedDataLength = ev.EncodedDataLength
+			req.endMono = ev.Timestamp
+			delete(n.pending, ev.RequestID)
+		}
+	case *network.EventLoadingFailed:
+		if req, ok := n.pending[ev.RequestID]; ok {
+			req.errorText = ev.ErrorText
+			req.blockedReason = ev.BlockedReason
+			req.endMono = ev.Timestamp
+			delete(n.pending, ev.RequestID)
+		}
+	}
+}
+
+func (n *networkRecorder) Summary() *NetworkSummary {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	s := &NetworkSummary{
+		Requests: len(n.requests),
+		Origins:  make([]string, 0),
+		Failed:   make([]FailedRequest, 0),
+	}
+	for _, req := range n.requests {
+		if origin := requestOrigin(req.request.URL); origin != "" && !slices.Contains(s.Origins, origin) {
+			s.Origins = append(s.Origins, origin)
+		}
+
+		if !req.failed() {
+			continue
+		}
+		f := FailedRequest{
+			URL:    req.request.URL,
+			Method: req.request.Method,
+			Error:  req.error(),
+		}
+		if req.response != nil {
+			f.Status = req.response.Status
+		}
+		s.Failed = append(s.Failed, f)
+	}
+	sort.Strings(s.Origins)
+	return s
+}
+
+// Requests implements requestlog.Source, it includes the requests that are still in flight.
+func (n *networkRecorder) Requests() []requestlog.Request {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	requests := make([]requestlog.Request, 0, len(n.requests))
+	for _, req := range n.requests {
+		r := requestlog.Request{
+			URL:          req.request.URL,
+			Method:       req.request.Method,
+			Origin:       requestOrigin(req.request.URL),
+			ResourceType: string(req.resourceType),
+			Target:       req.target,
+			Error:        req.error(),
+			RedirectURL:  req.redirectURL,
+			// A redirected request is done, the request it was redirected to has the same ID.
+			Pending:    n.pending[req.id] == req,
+			Started:    req.started,
+			DurationMs: float64(req.duration()) / float64(time.Millisecond),
+		}
+		if req.response != nil {
+			r.Status = req.response.Status
+		}
+		requests = append(requests, r)
+	}
+	return requests
+}
+
+// e.g. `https://global.frcapi.com`, empty for URLs without a host such as `data:` URLs.
+func requestOrigin(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
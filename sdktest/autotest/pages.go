@@ -0,0 +1,111 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// The most pages a test can go through with `sdktest.navigate()` and `sdktest.reload()`, so that a page that keeps
+// reloading itself fails right away instead of at the timeout.
+const maxTestPages = 20
+
+// What a test page asks for once its suite has run.
+type nextStep struct {
+	// "navigate" or "reload"
+	Action string `json:"action"`
+	// Relative to the current page, only set for "navigate".
+	URL string `json:"url"`
+}
+
+// The URL to navigate to from the current page, it keeps the query of the current page (e.g. the variant and the run
+// ID) unless it has one of its own.
+func (s *nextStep) resolve(current string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(s.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL to navigate to %q: %w", s.URL, err)
+	}
+
+	u := base.ResolveReference(ref)
+	if u.RawQuery == "" {
+		u.RawQuery = base.RawQuery
+	}
+	return u.String(), nil
+}
+
+// Runs the test suite of the open page, and of the pages it continues on, until a page is done or fails.
+func runPages(ctx context.Context, page Page, pageURL string) ([]sdkTestSuiteResult, error) {
+	var pages []sdkTestSuiteResult
+	for {
+		var result sdkTestSuiteResult
+		if err := page.Evaluate(ctx, "window.sdktest.run()", &result); err != nil {
+			return pages, &stepError{"retrieving test result from browser", err}
+		}
+		pages = append(pages, result)
+
+		next := result.Next
+		if next == nil || result.State == TestStatusFail {
+			return pages, nil
+		}
+		if len(pages) == maxTestPages {
+			return pages, &stepError{"continuing on the next page", fmt.Errorf("the test went through more than %d pages", maxTestPages)}
+		}
+
+		switch next.Action {
+		case "navigate":
+			u, err := next.resolve(pageURL)
+			if err != nil {
+				return pages, &stepError{"continuing on the next page", err}
+			}
+			if err := page.Navigate(ctx, u); err != nil {
+				return pages, err
+			}
+			pageURL = u
+		case "reload":
+			if err := page.Reload(ctx); err != nil {
+				return pages, err
+			}
+		default:
+			return pages, &stepError{"continuing on the next page", fmt.Errorf("unknown action %q", next.Action)}
+		}
+	}
+}
+
+// Combines the results of the pages a test went through. The subtests are prefixed with the page they ran on if there
+// was more than one, e.g. `page2: session count increased`, pages that were visited again are numbered, e.g.
+// `index (2): ...` after a reload.
+func mergePages(pages []sdkTestSuiteResult) (TestStatus, []SubtestResult) {
+	status := TestStatusPass
+	subtests := make([]SubtestResult, 0)
+	visits := make(map[string]int)
+	for _, p := range pages {
+		// Like the status of a single suite, any failure fails the test and otherwise any skip skips it.
+		if p.State == TestStatusFail {
+			status = TestStatusFail
+		} else if p.State == TestStatusSkip && status != TestStatusFail {
+			status = TestStatusSkip
+		}
+
+		visits[p.Page]++
+		label := p.Page
+		if n := visits[p.Page]; n > 1 {
+			label = fmt.Sprintf("%s (%d)", p.Page, n)
+		}
+
+		for _, st := range p.Results {
+			if len(pages) > 1 {
+				st.Name = label + ": " + st.Name
+			}
+			subtests = append(subtests, st)
+		}
+	}
+	return status, subtests
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"sync"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+)
+
+// Spreads the pages over several isolated browser instances, each new page goes to the instance with the fewest open
+// pages. This way the concurrent tests don't all share the tabs of a single browser process.
+type browserPool struct {
+	mu        sync.Mutex
+	instances []*pooledBrowser
+}
+
+type pooledBrowser struct {
+	Browser
+	// Number of pages currently open in the instance.
+	pages int
+}
+
+func (p *browserPool) add(b Browser) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.instances = append(p.instances, &pooledBrowser{Browser: b})
+}
+
+func (p *browserPool) Name() string {
+	return p.instances[0].Name()
+}
+
+func (p *browserPool) NewPage(run testRun, conf config.Config, logs *logCollector, requests *networkRecorder) (Page, error) {
+	p.mu.Lock()
+	b := p.instances[0]
+	for _, instance := range p.instances[1:] {
+		if instance.pages < b.pages {
+			b = instance
+		}
+	}
+	b.pages++
+	p.mu.Unlock()
+
+	release := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		b.pages--
+	}
+
+	page, err := b.NewPage(run, conf, logs, requests)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &pooledPage{Page: page, release: sync.OnceFunc(release)}, nil
+}
+
+func (p *browserPool) Close() {
+	var wg sync.WaitGroup
+	for _, b := range p.instances {
+		wg.Go(b.Close)
+	}
+	wg.Wait()
+}
+
+type pooledPage struct {
+	Page
+	release func()
+}
+
+func (p *pooledPage) Close() {
+	p.Page.Close()
+	p.release()
+}
+
+// The page of the instance, for the optional interfaces of pages such as coveragePage.
+func (p *pooledPage) Unwrap() Page {
+	return p.Page
+}
@@ -5,27 +5,30 @@
 package autotest
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 
 	"github.com/fatih/color"
 )
 
+// Prints the result of a test. It is safe for concurrent use, each result is written at once so the output of
+// tests running in parallel doesn't interleave.
 func (r *TestRunner) PrintTestResult(tr *TestResult) {
-	timing := color.HiBlackString(fmt.Sprintf("(%s)", tr.Timing))
+	var buf bytes.Buffer
+	r.printTestResult(&buf, tr)
 
-	if errors.Is(tr.InternalError, context.DeadlineExceeded) {
-		fmt.Fprintf(
-			color.Output,
-			"%s %s %s %s\n",
-			color.HiRedString("ERROR Timeout exceeded"),
-			tr.Name,
-			timing,
-			color.YellowString(tr.Message),
-		)
-		return
-	}
+	r.printMu.Lock()
+	defer r.printMu.Unlock()
+	color.Output.Write(buf.Bytes())
+}
+
+func (r *TestRunner) printTestResult(out io.Writer, tr *TestResult) {
+	timing := color.HiBlackString(formatTiming(tr))
 
 	switch tr.Status {
 	case "fail":
@@ -37,39 +40,203 @@ func (r *TestRunner) PrintTestResult(tr *TestResult) {
 
 		if errors.Is(tr.InternalError, context.DeadlineExceeded) { // Timeout in waiting for the notebook to load or run
 			fmt.Fprintf(
-				color.Output,
-				"%s %s %s %s\n%s",
-				color.HiRedString("FAIL"),
+				out,
+				"%s %s %s %s\n",
+				color.HiRedString("ERROR Timeout exceeded"),
 				tr.Name,
-				color.YellowString((fmt.Sprintf("Timeout exceeded (%s)", r.k.MustDuration("autotest.timeout")))),
-				tr.Message,
-				serveMsg,
+				timing,
+				color.YellowString(tr.Message),
 			)
 		} else if tr.InternalError != nil { // Something else went wrong talking to the browser
 			fmt.Fprintf(
-				color.Output,
-				"%s %s %s %s %s\n%s",
+				out,
+				"%s %s %s %s %s\n",
 				color.HiRedString("FAIL"),
 				tr.Name,
 				color.YellowString((fmt.Sprintf("AUTOTEST ERROR: %s", tr.InternalError.Error()))),
 				tr.Message,
 				timing,
-				serveMsg,
 			)
 		} else { // Ordinary fail (something was thrown in the notebook)
-			fmt.Fprintf(color.Output, "%s %s %s %s\n%s", color.HiRedString("FAIL"), tr.Name, color.RedString(tr.Message), timing, serveMsg)
+			fmt.Fprintf(out, "%s %s %s\n", color.HiRedString("FAIL"), tr.Name, timing)
 		}
+		// Subtests may have finished before a timeout or error
+		r.printSubtests(out, tr)
+		fmt.Fprint(out, serveMsg)
 	case "pass":
-		fmt.Fprintf(color.Output, "%s %s %s\n", color.GreenString("PASS"), tr.Name, timing)
+		fmt.Fprintf(out, "%s %s %s\n", color.GreenString("PASS"), tr.Name, timing)
+		r.printSubtests(out, tr)
+	case "flaky":
+		fmt.Fprintf(
+			out,
+			"%s %s %s %s\n",
+			color.MagentaString("FLAKY"),
+			tr.Name,
+			timing,
+			color.YellowString(fmt.Sprintf("passed on attempt %d", tr.Attempt)),
+		)
+		r.printSubtests(out, tr)
 	case "skip":
-		fmt.Fprintf(color.Output, "%s %s %s\n", color.YellowString("SKIP"), color.HiBlackString(tr.Name), timing)
+		fmt.Fprintf(out, "%s %s %s\n", color.YellowString("SKIP"), color.HiBlackString(tr.Name), timing)
+		r.printSubtests(out, tr)
 	default: // Should never happen
 		fmt.Fprintf(
-			color.Output,
+			out,
 			"%s %s %s\n",
 			color.HiRedString("ERROR Invalid Test Result status: "),
 			tr.Name,
 			timing,
 		)
 	}
+	r.printTimings(out, tr)
+	r.printWarnings(out, tr)
+	if tr.Status != TestStatusPass && tr.Status != TestStatusSkip && tr.Status != TestStatusFlaky {
+		r.printFailureDetails(out, tr)
+	}
+	r.printFailedAttempts(out, tr)
+}
+
+// Prints how fast the pages of the test loaded and the widgets got through their lifecycle.
+func (r *TestRunner) printTimings(out io.Writer, tr *TestResult) {
+	for _, p := range tr.TimingBreakdown.Pages {
+		events := formatPageLoadTimings(p)
+		if events == "" {
+			continue
+		}
+		fmt.Fprintf(out, "  %s\n", color.HiBlackString(fmt.Sprintf("page %s: %s", p.Page, events)))
+	}
+	for _, w := range tr.TimingBreakdown.Widgets {
+		milestones := formatWidgetTimings(w)
+		if milestones == "" {
+			continue
+		}
+		fmt.Fprintf(out, "  %s\n", color.HiBlackString(fmt.Sprintf("widget %s (%s): %s", w.ID, w.Page, milestones)))
+	}
+}
+
+func (r *TestRunner) printWarnings(out io.Writer, tr *TestResult) {
+	for _, w := range tr.Warnings {
+		fmt.Fprintf(out, "  %s\n", color.YellowString("warning: "+w))
+	}
+}
+
+// Prints why the earlier attempts of a retried test failed.
+func (r *TestRunner) printFailedAttempts(out io.Writer, tr *TestResult) {
+	for _, a := range tr.FailedAttempts {
+		timing := color.HiBlackString(fmt.Sprintf("(%s)", a.Timing))
+		fmt.Fprintf(out, "  %s %s\n", color.HiBlackString(fmt.Sprintf("attempt %d failed", a.Attempt)), timing)
+
+		if a.InternalError != nil {
+			fmt.Fprintf(out, "%s\n", color.RedString(indent(fmt.Sprintf("%s: %v", a.Message, a.InternalError), "    ")))
+		}
+		for _, st := range a.Subtests {
+			if st.Status != TestStatusFail {
+				continue
+			}
+			fmt.Fprintf(out, "    %s %s / %s\n", color.HiRedString("FAIL"), a.Name, st.Name)
+			for _, e := range st.Errors {
+				fmt.Fprintf(out, "%s\n", color.RedString(indent(e, "         ")))
+			}
+		}
+		for _, path := range a.Artifacts {
+			fmt.Fprintf(out, "    %s %s\n", color.HiBlackString("artifact"), color.HiBlackString(path))
+		}
+	}
+}
+
+// Lists the tests that only passed when retried.
+func printFlakySummary(out io.Writer, results []*TestResult) {
+	flaky := make([]*TestResult, 0)
+	for _, tr := range results {
+		if tr.Status == TestStatusFlaky {
+			flaky = append(flaky, tr)
+		}
+	}
+	if len(flaky) == 0 {
+		return
+	}
+	slices.SortFunc(flaky, func(a, b *TestResult) int { return strings.Compare(a.Name, b.Name) })
+
+	fmt.Fprintf(out, "\n%s\n", color.MagentaString(fmt.Sprintf("%d flaky tests, they passed after failing:", len(flaky))))
+	for _, tr := range flaky {
+		fmt.Fprintf(out, "  %s %s\n", tr.Name, color.HiBlackString(fmt.Sprintf("(passed on attempt %d)", tr.Attempt)))
+	}
+}
+
+// Prints what we know about the environment of a failed test: its console output, network requests and artifacts.
+func (r *TestRunner) printFailureDetails(out io.Writer, tr *TestResult) {
+	r.printLogs(out, tr)
+	r.printNetwork(out, tr)
+	r.printArtifacts(out, tr)
+}
+
+// Prints the console output of the test page and its iframes.
+func (r *TestRunner) printLogs(out io.Writer, tr *TestResult) {
+	if len(tr.Logs) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "  %s\n", color.HiBlackString("console:"))
+	for _, e := range tr.Logs {
+		line := indent(e.String(), "    ")
+		switch {
+		case e.IsError():
+			line = color.RedString(line)
+		case e.Level == "warning":
+			line = color.YellowString(line)
+		default:
+			line = color.HiBlackString(line)
+		}
+		fmt.Fprintf(out, "%s\n", line)
+	}
+}
+
+// Prints the origins the test page contacted and the requests that failed.
+func (r *TestRunner) printNetwork(out io.Writer, tr *TestResult) {
+	if tr.Network == nil || tr.Network.Requests == 0 {
+		return
+	}
+	fmt.Fprintf(
+		out,
+		"  %s\n",
+		color.HiBlackString(fmt.Sprintf("network: %d requests to %s", tr.Network.Requests, strings.Join(tr.Network.Origins, ", "))),
+	)
+	for _, f := range tr.Network.Failed {
+		fmt.Fprintf(out, "%s\n", color.RedString(indent(f.String(), "    ")))
+	}
+}
+
+// Lists the artifacts captured for a test, e.g. the screenshot of a failed test.
+func (r *TestRunner) printArtifacts(out io.Writer, tr *TestResult) {
+	for _, path := range tr.Artifacts {
+		fmt.Fprintf(out, "  %s %s\n", color.HiBlackString("artifact"), color.HiBlackString(path))
+	}
+	for _, e := range tr.ArtifactErrors {
+		fmt.Fprintf(out, "  %s\n", color.YellowString(fmt.Sprintf("Failed to capture artifact: %s", e)))
+	}
+}
+
+// Prints the `sdktest.test(...)` results of a test page indented below it, e.g. `FAIL csp / widget completes after starting`.
+func (r *TestRunner) printSubtests(out io.Writer, tr *TestResult) {
+	for _, st := range tr.Subtests {
+		timing := color.HiBlackString(fmt.Sprintf("(%s)", st.Timing()))
+		name := fmt.Sprintf("%s / %s", tr.Name, st.Name)
+
+		switch st.Status {
+		case TestStatusPass:
+			fmt.Fprintf(out, "  %s %s %s\n", color.GreenString("PASS"), name, timing)
+		case TestStatusSkip:
+			fmt.Fprintf(out, "  %s %s %s\n", color.YellowString("SKIP"), color.HiBlackString(name), timing)
+		case TestStatusFail:
+			fmt.Fprintf(out, "  %s %s %s\n", color.HiRedString("FAIL"), name, timing)
+			for _, e := range st.Errors {
+				fmt.Fprintf(out, "%s\n", color.RedString(indent(e, "       ")))
+			}
+		default: // The test never finished
+			fmt.Fprintf(out, "  %s %s %s\n", color.HiRedString(strings.ToUpper(string(st.Status))), name, timing)
+		}
+	}
+}
+
+func indent(s string, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
 }
@@ -6,12 +6,18 @@ package autotest
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/chromedp/cdproto/runtime"
-	"github.com/chromedp/chromedp"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/coverage"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/mockapi"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/render"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/requestlog"
 	"github.com/knadh/koanf/v2"
 )
 
@@ -23,6 +29,8 @@ const (
 	TestStatusFail      TestStatus = "fail"
 	TestStatusPass      TestStatus = "pass"
 	TestStatusSkip      TestStatus = "skip"
+	// Failed at first but passed (or skipped) when retried, only used for the result of a whole test.
+	TestStatusFlaky TestStatus = "flaky"
 )
 
 type JSError struct {
@@ -36,118 +44,250 @@ type JSError struct {
 }
 
 type TestResult struct {
+	// The name the result is reported under, including the variant, e.g. `csp[compat,min]`.
 	Name string
 	URL  string
+	// Name of the test folder
+	Test    string
+	Variant Variant
+	// The browser driver it ran in, e.g. "chromium".
+	Browser string
+	RunID   string
 
-	// "PASS"" | "FAIL" | "SKIP"
+	// "pass" | "fail" | "skip" | "flaky"
 	Status  TestStatus
 	Message string
 
+	// Which attempt at running the test this is the result of, starting at 1, see `autotest.retries`.
+	Attempt int
+	// The earlier attempts that failed, in order, if the test was retried.
+	FailedAttempts []*TestResult
+
 	Timing        time.Duration
 	InternalError error
+	// Where the time went, including how fast the widgets got through their lifecycle.
+	TimingBreakdown TimingBreakdown
+	// Problems that don't fail the test, such as exceeded timing budgets with `budgets.on_exceed: warn`.
+	Warnings []string
+
+	// Results of the individual `sdktest.test(...)` calls, empty if the test suite didn't run to completion.
+	Subtests []SubtestResult
+
+	// Console messages, uncaught errors and browser log messages of the test page and its iframes.
+	Logs []LogEntry
+
+	// The requests made by the test page and its iframes.
+	Network *NetworkSummary
+
+	// Paths of the files written to `autotest.artifacts_dir` for this test, such as the screenshot of a failed test.
+	Artifacts []string
+	// Artifacts that could not be captured or written.
+	ArtifactErrors []string
+}
+
+// Result of a single `sdktest.test(...)` call within a test page.
+type SubtestResult struct {
+	Name   string     `json:"name"`
+	Status TestStatus `json:"status"`
+	// Error messages as displayed on the test page.
+	Errors []string `json:"errors"`
+	// The same errors, including their JS stack.
+	RawErrors []JSError `json:"rawErrors"`
+	// In milliseconds
+	DurationMs float64 `json:"duration"`
+}
+
+func (s SubtestResult) Timing() time.Duration {
+	return time.Duration(s.DurationMs * float64(time.Millisecond))
 }
 
-type sdkTestResult struct {
-	State     TestStatus `json:"status"`
-	RawErrors []JSError  `json:"rawErrors"`
-	Errors    []string   `json:"errors"`
+// The JS stacks of all errors, falls back to the error message for errors without a stack.
+func (s SubtestResult) Stack() string {
+	stacks := make([]string, 0, len(s.RawErrors))
+	for _, e := range s.RawErrors {
+		if e.Stack != "" {
+			stacks = append(stacks, e.Stack)
+		} else {
+			stacks = append(stacks, e.Message)
+		}
+	}
+	return strings.Join(stacks, "\n\n")
 }
 
 type sdkTestSuiteResult struct {
 	State   TestStatus      `json:"status"`
-	Results []sdkTestResult `json:"results"`
+	Results []SubtestResult `json:"results"`
+	// Name of the page of the test the suite ran on, e.g. `index` or `page2`.
+	Page    string      `json:"page"`
+	Next    *nextStep   `json:"next"`
+	Timings pageTimings `json:"timings"`
 }
 
 type TestRunner struct {
-	ctx context.Context
-	k   *koanf.Koanf
+	browser Browser
+	k       *koanf.Koanf
+
+	requestLog *requestlog.Store
+	mockAPI    *mockapi.Server
+	// Collects the JS coverage of the SDK across all tests, nil if `autotest.coverage_dir` isn't set.
+	coverage *coverage.Collector
 
-	cancelCtx context.CancelFunc
+	// Serialises the printed test results, see PrintTestResult.
+	printMu sync.Mutex
 }
 
-func NewTestRunner(k *koanf.Koanf) *TestRunner {
-	opts := defaultAllocatorOptions[:]
+// A single run of a test page in the browser.
+type testRun struct {
+	Test    string
+	Variant Variant
+	// Passed to the page as `?run=<id>`, it identifies the run to the sdktest server (see requestlog).
+	ID string
+}
 
-	if k.Bool("autotest.headless") {
-		opts = append(opts, chromedp.Headless)
+func newTestRun(name string, variant Variant) testRun {
+	return testRun{
+		Test:    name,
+		Variant: variant,
+		ID:      rand.Text(),
 	}
-	execPath := k.String("autotest.browser_exec_path")
-	if execPath != "" {
-		opts = append(opts, chromedp.ExecPath(execPath))
+}
+
+func NewTestRunner(k *koanf.Koanf, requestLog *requestlog.Store, mockAPI *mockapi.Server) *TestRunner {
+	browser := newBrowser(k)
+	return &TestRunner{
+		browser:    browser,
+		k:          k,
+		requestLog: requestLog,
+		mockAPI:    mockAPI,
+		coverage:   newCoverageCollector(k.String("autotest.coverage_dir"), browser),
 	}
+}
 
-	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
-	taskCtx, _ := chromedp.NewContext(allocCtx)
+// Closes the browser.
+func (r *TestRunner) Close() {
+	r.browser.Close()
+}
 
-	// ensure the first tab is created (this way the browser doesn't keep getting closed)
-	if err := chromedp.Run(taskCtx); err != nil {
-		panic(err)
+func (r *TestRunner) testURL(run testRun) string {
+	// The test pages only check for the presence of the `compat` and `min` flags.
+	query := run.Variant.query()
+	query = append(query, requestlog.RunParam+"="+url.QueryEscape(run.ID))
+	if subtest := r.k.String("autotest.subtest"); subtest != "" {
+		query = append(query, "subtest="+url.QueryEscape(subtest))
 	}
 
-	return &TestRunner{
-		ctx:       taskCtx,
-		cancelCtx: cancel,
-		k:         k,
+	return fmt.Sprintf("http://localhost:%d/test/%s/?%s", r.k.MustInt("port"), run.Test, strings.Join(query, "&"))
+}
+
+// How often a failing test is retried, the `retries` of its config.yaml or else `autotest.retries`.
+func (r *TestRunner) retries(conf config.Config) int {
+	if conf.Retries != nil {
+		return max(*conf.Retries, 0)
 	}
+	return max(r.k.Int("autotest.retries"), 0)
 }
 
-func (r *TestRunner) runTest(name string) *TestResult {
-	taskCtx, cancel := chromedp.NewContext(r.ctx)
-	defer cancel()
+// Runs the test, and again as a new run for each retry while it fails. The result is that of the last attempt, with
+// the status flaky if it didn't fail.
+func (r *TestRunner) runTest(run testRun) *TestResult {
+	conf, _ := render.LoadTestCaseConfig(r.k, r.k.MustString("test_folder"), run.Test)
+	retries := r.retries(conf)
 
+	var failed []*TestResult
+	for attempt := 1; ; attempt++ {
+		tr := r.runAttempt(run, conf, attempt)
+		if tr.Status == TestStatusPass || tr.Status == TestStatusSkip || attempt > retries {
+			tr.FailedAttempts = failed
+			if len(failed) > 0 && tr.Status != TestStatusFail {
+				tr.Status = TestStatusFlaky
+			}
+			return tr
+		}
+
+		failed = append(failed, tr)
+		run = newTestRun(run.Test, run.Variant)
+	}
+}
+
+func (r *TestRunner) runAttempt(run testRun, conf config.Config, attempt int) *TestResult {
 	timeout := r.k.MustDuration("autotest.timeout")
-	targetURL := fmt.Sprintf("http://localhost:%d/test/%s/", r.k.MustInt("port"), name)
+	targetURL := r.testURL(run)
 
-	ctx, cancel := context.WithTimeout(taskCtx, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	tr := &TestResult{
-		URL:    targetURL,
-		Name:   name,
-		Status: "FAIL", // We overwrite it in the other cases
+		URL:     targetURL,
+		Name:    run.Variant.testName(run.Test),
+		Test:    run.Test,
+		Variant: run.Variant,
+		Browser: r.browser.Name(),
+		RunID:   run.ID,
+		Status:  TestStatusFail, // We overwrite it in the other cases
+		Attempt: attempt,
 	}
-	defer func(t time.Time) {
-		tr.Timing = time.Since(t)
-	}(time.Now())
+	r.clearArtifacts(tr)
 
-	err := chromedp.Run(ctx, chromedp.Navigate(targetURL))
+	logs := newLogCollector()
+	requests := newNetworkRecorder()
+	newPageStarted := time.Now()
+	page, err := r.browser.NewPage(run, conf, logs, requests)
 	if err != nil {
-		tr.InternalError = err
-		tr.Message = "waiting for browser to open page"
+		tr.setInternalError(err, "opening a new tab")
 		return tr
 	}
+	tr.TimingBreakdown.NewPage = time.Since(newPageStarted)
+	defer page.Close()
+	r.requestLog.Register(run.ID, requests)
+	defer r.requestLog.Unregister(run.ID)
+	defer r.mockAPI.EndRun(run.ID)
+
+	// Deferred before the timing so that capturing doesn't count towards the test's time.
+	defer func(started time.Time) {
+		tr.Logs = logs.Entries()
+		tr.Network = requests.Summary()
+		r.writeHAR(tr, requests, started)
+		r.collectCoverage(page, tr)
 
-	if err := chromedp.Run(ctx, chromedp.WaitReady("body")); err != nil {
-		tr.InternalError = err
-		tr.Message = "waiting for body"
+		if tr.Status != TestStatusPass && tr.Status != TestStatusSkip {
+			r.captureFailure(page, tr)
+		}
+	}(time.Now())
+	defer func(t time.Time) {
+		tr.Timing = time.Since(t)
+	}(time.Now())
+
+	if err := r.startCoverage(ctx, page); err != nil {
+		tr.setInternalError(err, "starting JS coverage")
 		return tr
 	}
 
-	if err := chromedp.Run(ctx, chromedp.WaitReady(".sdktest-start")); err != nil {
-		tr.InternalError = err
-		tr.Message = "waiting to start"
+	loadStarted := time.Now()
+	if err := page.Open(ctx, targetURL); err != nil {
+		tr.setInternalError(err, "waiting for browser to open page")
 		return tr
 	}
+	tr.TimingBreakdown.Load = time.Since(loadStarted)
 
-	// We click so that the browser is focused, otherwise the focus event doesn't work in some cases for form elements.
-	chromedp.Run(ctx, chromedp.MouseClickXY(0, 0))
-
-	var testResult sdkTestSuiteResult
-	if err := chromedp.Run(ctx, chromedp.Evaluate("window.sdktest.run()", &testResult, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
-		return p.WithAwaitPromise(true)
-	})); err != nil {
-		tr.InternalError = err
-		tr.Message = "retrieving test result from browser"
+	suiteStarted := time.Now()
+	pages, err := runPages(ctx, page, targetURL)
+	tr.TimingBreakdown.Suite = time.Since(suiteStarted)
+	tr.TimingBreakdown.Pages = pageLoadTimings(pages)
+	tr.TimingBreakdown.Widgets = widgetTimings(pages)
+	if err != nil {
+		_, tr.Subtests = mergePages(pages)
+		tr.setInternalError(err, "retrieving test result from browser")
 		return tr
 	}
 
-	tr.Status = testResult.State
+	tr.Status, tr.Subtests = mergePages(pages)
+	applyBudgets(tr, conf.Budgets)
 
-	errMsg := ""
-	for _, r := range testResult.Results {
-		errMsg += strings.Join(r.Errors, "\n")
+	errs := make([]string, 0)
+	for _, st := range tr.Subtests {
+		errs = append(errs, st.Errors...)
 	}
-	tr.Message = errMsg
+	tr.Message = strings.Join(errs, "\n")
 
 	return tr
 }
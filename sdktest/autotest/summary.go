@@ -0,0 +1,200 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Exit codes of autotest, so that CI can tell failing tests apart from autotest itself not working.
+const (
+	ExitOK = 0
+	// One or more tests failed.
+	ExitTestsFailed = 1
+	// Autotest couldn't run (some of) the tests or report on them, e.g. the browser didn't start, a test page didn't
+	// load or the JUnit report couldn't be written. Go exits with it on panics too. It takes precedence over
+	// ExitTestsFailed.
+	ExitHarnessError = 2
+)
+
+// Like log.Fatalf, but exits with ExitHarnessError.
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	os.Exit(ExitHarnessError)
+}
+
+// Whether the result is an error of autotest (or the browser) rather than a failure of the test itself. A test that
+// runs into the timeout has failed, it most likely waits for something that never happens.
+func (tr *TestResult) isHarnessError() bool {
+	return tr.InternalError != nil && !errors.Is(tr.InternalError, context.DeadlineExceeded)
+}
+
+// The results of a run of autotest, it is safe for concurrent use.
+type runResults struct {
+	mu      sync.Mutex
+	results []*TestResult
+	counts  map[TestStatus]int
+	// Results that are harness errors, they are counted as failures too.
+	errors int
+	// Problems of autotest besides the tests themselves, e.g. a report that couldn't be written.
+	harnessErrors []string
+}
+
+func newRunResults() *runResults {
+	return &runResults{
+		counts: make(map[TestStatus]int),
+	}
+}
+
+func (r *runResults) add(tr *TestResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.results = append(r.results, tr)
+	r.counts[tr.Status]++
+	if tr.isHarnessError() {
+		r.errors++
+	}
+}
+
+func (r *runResults) addHarnessError(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.harnessErrors = append(r.harnessErrors, msg)
+}
+
+// The results sorted by name.
+func (r *runResults) Results() []*TestResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := slices.Clone(r.results)
+	slices.SortFunc(results, func(a, b *TestResult) int { return strings.Compare(a.Name, b.Name) })
+	return results
+}
+
+// The number of results with the status.
+func (r *runResults) Count(status TestStatus) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.counts[status]
+}
+
+func (r *runResults) Summary(timing time.Duration) *RunSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := &RunSummary{
+		Total:         len(r.results),
+		Passed:        r.counts[TestStatusPass],
+		Skipped:       r.counts[TestStatusSkip],
+		Flaky:         r.counts[TestStatusFlaky],
+		Errors:        r.errors,
+		HarnessErrors: slices.Clone(r.harnessErrors),
+		ExitCode:      r.exitCode(),
+		DurationMs:    float64(timing) / float64(time.Millisecond),
+	}
+	// Anything else never finished, we count it as a failure.
+	s.Failed = s.Total - s.Passed - s.Skipped - s.Flaky
+	for _, tr := range r.results {
+		if tr.Status == TestStatusFlaky {
+			s.FlakyTests = append(s.FlakyTests, tr.Name)
+		}
+	}
+	slices.Sort(s.FlakyTests)
+	return s
+}
+
+func (r *runResults) exitCode() int {
+	if r.errors > 0 || len(r.harnessErrors) > 0 {
+		return ExitHarnessError
+	}
+	for status, n := range r.counts {
+		if n > 0 && status != TestStatusPass && status != TestStatusSkip && status != TestStatusFlaky {
+			return ExitTestsFailed
+		}
+	}
+	return ExitOK
+}
+
+// The exit code of the run, see ExitTestsFailed and ExitHarnessError.
+func (r *runResults) ExitCode() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.exitCode()
+}
+
+// Why a test failed in a single line, e.g. `widget completes: Timeout of 20000ms exceeded`.
+func failureReason(tr *TestResult) string {
+	if tr.InternalError != nil {
+		return fmt.Sprintf("%s: %v", tr.Message, tr.InternalError)
+	}
+	for _, st := range tr.Subtests {
+		if st.Status != TestStatusFail {
+			continue
+		}
+		if len(st.Errors) == 0 {
+			return st.Name
+		}
+		return fmt.Sprintf("%s: %s", st.Name, st.Errors[0])
+	}
+	return tr.Message
+}
+
+// Prints the counts per status and a table of the tests that failed.
+func (r *runResults) print(out io.Writer) {
+	results := r.Results()
+	summary := r.Summary(0)
+
+	failed := make([]*TestResult, 0)
+	for _, tr := range results {
+		if tr.Status != TestStatusPass && tr.Status != TestStatusSkip && tr.Status != TestStatusFlaky {
+			failed = append(failed, tr)
+		}
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintf(out, "\n%s\n", color.RedString("Failed tests:"))
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, tr := range failed {
+			status := "FAIL"
+			if tr.isHarnessError() {
+				status = "ERROR"
+			}
+			// Only the first line of the reason, the details were printed with the result of the test.
+			reason, _, _ := strings.Cut(failureReason(tr), "\n")
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", tr.Name, status, reason)
+		}
+		tw.Flush()
+	}
+
+	for _, msg := range summary.HarnessErrors {
+		fmt.Fprintf(out, "%s\n", color.RedString(msg))
+	}
+
+	counts := []string{
+		fmt.Sprintf("%d passed", summary.Passed),
+		fmt.Sprintf("%d failed", summary.Failed-summary.Errors),
+		fmt.Sprintf("%d errors", summary.Errors),
+		fmt.Sprintf("%d flaky", summary.Flaky),
+		fmt.Sprintf("%d skipped", summary.Skipped),
+	}
+	fmt.Fprintf(out, "\n%d tests: %s\n", summary.Total, strings.Join(counts, ", "))
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// The target name of the test page itself, iframes are named by their URL.
+const pageTargetName = "page"
+
+// The out-of-process iframes of a test page we have attached to.
+type frameTargets struct {
+	mu       sync.Mutex
+	attached map[target.ID]bool
+	// The chromedp contexts of the iframes, by target ID (which is the same as the frame ID).
+	contexts map[target.ID]context.Context
+	// Called for every iframe we attach to, so per-target settings (like network emulation) can be applied to it.
+	attachHooks []func(frameCtx context.Context)
+}
+
+// Calls fn for the iframes we have attached to so far and all that we attach to from now on.
+func (f *frameTargets) onAttach(fn func(frameCtx context.Context)) {
+	f.mu.Lock()
+	f.attachHooks = append(f.attachHooks, fn)
+	f.mu.Unlock()
+
+	for _, frameCtx := range f.all() {
+		fn(frameCtx)
+	}
+}
+
+// The chromedp contexts of all iframes we have attached to.
+func (f *frameTargets) all() []context.Context {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	contexts := make([]context.Context, 0, len(f.contexts))
+	for _, frameCtx := range f.contexts {
+		contexts = append(contexts, frameCtx)
+	}
+	return contexts
+}
+
+// Returns the chromedp context of an out-of-process iframe, it waits for us to attach to the iframe if needed.
+func (f *frameTargets) context(ctx context.Context, id target.ID) (context.Context, bool) {
+	for {
+		f.mu.Lock()
+		frameCtx, ok := f.contexts[id]
+		f.mu.Unlock()
+		if ok {
+			return frameCtx, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Calls fn with the events of the page in ctx and of all iframes within it. Same-origin iframes share the target of
+// their page, cross-origin ones (such as the agent and widget of the real API) are out-of-process and have a target of
+// their own which we attach to. Attaching enables the Runtime, Log and Network domains of the iframe.
+//
+// fn is called synchronously when handling events, so it must not block.
+func listenPageAndFrames(ctx context.Context, fn func(targetName string, ev any), onError func(targetName string, err error)) *frameTargets {
+	frames := &frameTargets{
+		attached: make(map[target.ID]bool),
+		contexts: make(map[target.ID]context.Context),
+	}
+
+	chromedp.ListenTarget(ctx, func(ev any) {
+		fn(pageTargetName, ev)
+	})
+
+	chromedp.ListenTarget(ctx, func(ev any) {
+		attachedEv, ok := ev.(*target.EventAttachedToTarget)
+		if !ok || attachedEv.TargetInfo.Type != "iframe" {
+			return
+		}
+
+		frames.mu.Lock()
+		seen := frames.attached[attachedEv.TargetInfo.TargetID]
+		frames.attached[attachedEv.TargetInfo.TargetID] = true
+		frames.mu.Unlock()
+		if seen {
+			return
+		}
+
+		// We can't run actions from within a listener.
+		go func(info *target.Info) {
+			// Detached when the test's tab is closed.
+			frameCtx, _ := chromedp.NewContext(ctx, chromedp.WithTargetID(info.TargetID))
+			chromedp.ListenTarget(frameCtx, func(ev any) {
+				fn(info.URL, ev)
+			})
+			if err := chromedp.Run(frameCtx); err != nil {
+				if ctx.Err() == nil {
+					onError(info.URL, err)
+				}
+				return
+			}
+
+			frames.mu.Lock()
+			frames.contexts[info.TargetID] = frameCtx
+			hooks := append([]func(context.Context){}, frames.attachHooks...)
+			frames.mu.Unlock()
+
+			for _, hook := range hooks {
+				hook(frameCtx)
+			}
+		}(attachedEv.TargetInfo)
+	})
+
+	return frames
+}
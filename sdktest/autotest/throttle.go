@@ -0,0 +1,108 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+)
+
+// Emulates network conditions for a test page and its out-of-process iframes, the emulation is per target.
+type networkEmulator struct {
+	frames *frameTargets
+
+	mu      sync.Mutex
+	current config.NetworkConditions
+	// Whether we have emulated anything, otherwise there is nothing to apply to new iframes.
+	active bool
+}
+
+func newNetworkEmulator(frames *frameTargets) *networkEmulator {
+	e := &networkEmulator{
+		frames: frames,
+	}
+	frames.onAttach(func(frameCtx context.Context) {
+		e.mu.Lock()
+		c, active := e.current, e.active
+		e.mu.Unlock()
+		if active {
+			// The iframe may already be gone again, that's fine.
+			chromedp.Run(frameCtx, emulateNetworkConditions(c))
+		}
+	})
+	return e
+}
+
+func emulateNetworkConditions(c config.NetworkConditions) chromedp.Tasks {
+	throughput := func(t float64) float64 {
+		if t <= 0 {
+			return -1 // Disables throttling
+		}
+		return t
+	}
+	latency := float64(c.Latency) / float64(time.Millisecond)
+
+	return chromedp.Tasks{
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			_, err := network.EmulateNetworkConditionsByRule(c.Offline, []*network.Conditions{{
+				// An empty pattern matches all requests.
+				URLPattern:         "",
+				Latency:            latency,
+				DownloadThroughput: throughput(c.DownloadThroughput),
+				UploadThroughput:   throughput(c.UploadThroughput),
+			}}).Do(ctx)
+			return err
+		}),
+		// The above doesn't change `navigator.onLine` and the `online`/`offline` events, which the SDK listens to.
+		network.OverrideNetworkState(c.Offline, latency, throughput(c.DownloadThroughput), throughput(c.UploadThroughput)),
+	}
+}
+
+// Applies the conditions to the test page and all of its out-of-process iframes.
+func (e *networkEmulator) set(ctx context.Context, c config.NetworkConditions) error {
+	e.mu.Lock()
+	e.current = c
+	e.active = true
+	e.mu.Unlock()
+
+	if err := chromedp.Run(ctx, emulateNetworkConditions(c)); err != nil {
+		return fmt.Errorf("emulating network conditions: %w", err)
+	}
+
+	for _, frameCtx := range e.frames.all() {
+		chromedp.Run(frameCtx, emulateNetworkConditions(c))
+	}
+	return nil
+}
+
+// Applies the initial conditions of the test config and schedules its changes, relative to now.
+func (e *networkEmulator) start(ctx context.Context, n config.Network) error {
+	if n.IsZero() {
+		return nil
+	}
+
+	if !n.NetworkConditions.IsZero() {
+		if err := e.set(ctx, n.NetworkConditions); err != nil {
+			return err
+		}
+	}
+
+	for _, change := range n.Changes {
+		go func(change config.NetworkChange) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(change.After):
+				e.set(ctx, change.NetworkConditions)
+			}
+		}(change)
+	}
+	return nil
+}
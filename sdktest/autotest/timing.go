@@ -0,0 +1,209 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package autotest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+)
+
+// Where the time of a test run went.
+type TimingBreakdown struct {
+	// Opening the tab and setting it up, e.g. for emulation.
+	NewPage time.Duration
+	// Loading the test page until its suite is ready to start.
+	Load time.Duration
+	// Running the test suites of the pages, including navigating between them.
+	Suite time.Duration
+
+	// When the pages of the test loaded, in the order they were visited.
+	Pages []PageLoadTimings
+	// The lifecycle of the widgets on the pages of the test.
+	Widgets []WidgetTimings
+}
+
+// When a page of the test got through its DOMContentLoaded and load events, as seen by the page itself. In
+// milliseconds since the page started loading, zero for events that didn't happen (yet).
+type PageLoadTimings struct {
+	// e.g. `index` or `page2`.
+	Page               string  `json:"page"`
+	DOMContentLoadedMs float64 `json:"domContentLoadedMs"`
+	LoadMs             float64 `json:"loadMs"`
+}
+
+// When the page loaded and its widgets went through their lifecycle, as recorded by sdktestlib. In milliseconds since
+// the page started loading.
+type pageTimings struct {
+	DOMContentLoadedMs float64         `json:"domContentLoaded"`
+	LoadMs             float64         `json:"load"`
+	Widgets            []WidgetTimings `json:"widgets"`
+}
+
+type WidgetTimings struct {
+	// The page of the test the widget was on, e.g. `index` or `page2`.
+	Page string `json:"page"`
+	ID   string `json:"id"`
+	// When the widget first entered each state, in milliseconds since the page started loading.
+	States map[string]float64 `json:"states"`
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// When the widget first entered the state, since the page started loading.
+func (w WidgetTimings) at(state string) (time.Duration, bool) {
+	ms, ok := w.States[state]
+	return msDuration(ms), ok
+}
+
+// The time it took the widget to get from one state to the other.
+func (w WidgetTimings) between(from, to string) (time.Duration, bool) {
+	start, ok := w.at(from)
+	if !ok {
+		return 0, false
+	}
+	end, ok := w.at(to)
+	return end - start, ok
+}
+
+// A milestone of the lifecycle of a widget.
+type widgetMilestone struct {
+	// e.g. "ready"
+	name    string
+	measure func(w WidgetTimings) (time.Duration, bool)
+	// The budget of the milestone in milliseconds, zero if none.
+	budget func(b config.TimingBudgets) int
+	// The name of the budget in the config.
+	budgetKey string
+}
+
+var widgetMilestones = []widgetMilestone{
+	{
+		name:      "ready",
+		measure:   func(w WidgetTimings) (time.Duration, bool) { return w.at("unactivated") },
+		budget:    func(b config.TimingBudgets) int { return b.WidgetReadyMs },
+		budgetKey: "widget_ready_ms",
+	},
+	{
+		name:      "solving",
+		measure:   func(w WidgetTimings) (time.Duration, bool) { return w.between("activating", "solving") },
+		budget:    func(b config.TimingBudgets) int { return b.WidgetSolvingMs },
+		budgetKey: "widget_solving_ms",
+	},
+	{
+		name:      "completed",
+		measure:   func(w WidgetTimings) (time.Duration, bool) { return w.between("activating", "completed") },
+		budget:    func(b config.TimingBudgets) int { return b.WidgetCompletedMs },
+		budgetKey: "widget_completed_ms",
+	},
+}
+
+// The load timings of all pages.
+func pageLoadTimings(pages []sdkTestSuiteResult) []PageLoadTimings {
+	timings := make([]PageLoadTimings, 0, len(pages))
+	for _, p := range pages {
+		timings = append(timings, PageLoadTimings{
+			Page:               p.Page,
+			DOMContentLoadedMs: p.Timings.DOMContentLoadedMs,
+			LoadMs:             p.Timings.LoadMs,
+		})
+	}
+	return timings
+}
+
+// The widget timings of all pages, labeled with the page they were on.
+func widgetTimings(pages []sdkTestSuiteResult) []WidgetTimings {
+	widgets := make([]WidgetTimings, 0)
+	for _, p := range pages {
+		for _, w := range p.Timings.Widgets {
+			w.Page = p.Page
+			widgets = append(widgets, w)
+		}
+	}
+	return widgets
+}
+
+// Checks the widgets against the budgets, returning a message for every budget that was exceeded. Milestones a
+// widget didn't reach aren't checked, the test itself decides whether that is a failure.
+func checkBudgets(budgets config.TimingBudgets, widgets []WidgetTimings) []string {
+	exceeded := make([]string, 0)
+	for _, w := range widgets {
+		for _, m := range widgetMilestones {
+			budget := time.Duration(m.budget(budgets)) * time.Millisecond
+			took, ok := m.measure(w)
+			if budget <= 0 || !ok || took <= budget {
+				continue
+			}
+			exceeded = append(exceeded, fmt.Sprintf(
+				"%s: widget %s on page %s was %s after %s, the budget is %s",
+				m.budgetKey, w.ID, w.Page, m.name, took.Round(time.Millisecond), budget,
+			))
+		}
+	}
+	return exceeded
+}
+
+// Applies the timing budgets of the test to its result: an exceeded budget fails it (as the subtest `timing budgets`)
+// or adds a warning, depending on `budgets.on_exceed`.
+func applyBudgets(tr *TestResult, budgets config.TimingBudgets) {
+	exceeded := checkBudgets(budgets, tr.TimingBreakdown.Widgets)
+	if len(exceeded) == 0 {
+		return
+	}
+	if budgets.OnExceed == "warn" {
+		tr.Warnings = append(tr.Warnings, exceeded...)
+		return
+	}
+
+	tr.Subtests = append(tr.Subtests, SubtestResult{
+		Name:   "timing budgets",
+		Status: TestStatusFail,
+		Errors: exceeded,
+	})
+	tr.Status = TestStatusFail
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// The time of the test and where it went, e.g. `(3.5s: tab 120ms, load 800ms, suite 2.58s)`.
+func formatTiming(tr *TestResult) string {
+	t := tr.TimingBreakdown
+	if t.Load == 0 {
+		return fmt.Sprintf("(%s)", formatDuration(tr.Timing))
+	}
+	return fmt.Sprintf(
+		"(%s: tab %s, load %s, suite %s)",
+		formatDuration(tr.Timing), formatDuration(t.NewPage), formatDuration(t.Load), formatDuration(t.Suite),
+	)
+}
+
+// The load events the page got through, e.g. `domContentLoaded 120ms, load 340ms`.
+func formatPageLoadTimings(p PageLoadTimings) string {
+	events := make([]string, 0, 2)
+	if p.DOMContentLoadedMs > 0 {
+		events = append(events, "domContentLoaded "+formatDuration(msDuration(p.DOMContentLoadedMs)))
+	}
+	if p.LoadMs > 0 {
+		events = append(events, "load "+formatDuration(msDuration(p.LoadMs)))
+	}
+	return strings.Join(events, ", ")
+}
+
+// The milestones the widget reached, e.g. `ready 450ms, solving 1.1s, completed 2.3s`.
+func formatWidgetTimings(w WidgetTimings) string {
+	milestones := make([]string, 0, len(widgetMilestones))
+	for _, m := range widgetMilestones {
+		if took, ok := m.measure(w); ok {
+			milestones = append(milestones, fmt.Sprintf("%s %s", m.name, formatDuration(took)))
+		}
+	}
+	return strings.Join(milestones, ", ")
+}
@@ -0,0 +1,217 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package bidi is a minimal WebDriver BiDi client, just enough for autotest to drive Firefox.
+// See https://w3c.github.io/webdriver-bidi/ for the commands and events.
+package bidi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// ErrClosed is returned for commands that were pending or sent after the connection closed.
+var ErrClosed = errors.New("bidi: connection closed")
+
+// An event sent by the browser, such as `log.entryAdded`.
+type Event struct {
+	Method string
+	Params json.RawMessage
+}
+
+// An error response to a command.
+type Error struct {
+	// e.g. "no such frame" or "unknown command"
+	Code       string `json:"error"`
+	Message    string `json:"message"`
+	Stacktrace string `json:"stacktrace"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+type command struct {
+	ID     int64  `json:"id"`
+	Method string `json:"method"`
+	Params any    `json:"params"`
+}
+
+// A response or an event, told apart by Type.
+type message struct {
+	// "success", "error" or "event"
+	Type   string          `json:"type"`
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Error
+}
+
+// A connection to the WebDriver BiDi server of a browser.
+type Conn struct {
+	conn    net.Conn
+	rw      io.ReadWriter
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan message
+	// Called for every event, in the order they were received.
+	handlers []eventHandler
+	closed   bool
+}
+
+type eventHandler struct {
+	id int64
+	fn func(Event)
+}
+
+// Reads buffered handshake data before reading from the connection.
+type bufferedConn struct {
+	io.Reader
+	io.Writer
+}
+
+// Dial connects to a BiDi websocket URL, e.g. `ws://127.0.0.1:9222/session`.
+func Dial(ctx context.Context, url string) (*Conn, error) {
+	conn, br, _, err := ws.Dial(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		conn:    conn,
+		rw:      conn,
+		pending: make(map[int64]chan message),
+	}
+	if br != nil {
+		c.rw = bufferedConn{Reader: io.MultiReader(br, conn), Writer: conn}
+	}
+	go c.read()
+	return c, nil
+}
+
+func (c *Conn) read() {
+	for {
+		data, err := wsutil.ReadServerText(c.rw)
+		if err != nil {
+			c.Close()
+			return
+		}
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		if msg.Type == "event" {
+			handlers := append([]eventHandler(nil), c.handlers...)
+			c.mu.Unlock()
+
+			for _, h := range handlers {
+				h.fn(Event{Method: msg.Method, Params: msg.Params})
+			}
+			continue
+		}
+
+		ch, ok := c.pending[msg.ID]
+		delete(c.pending, msg.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
+
+// Calls fn for every event until the returned function is called. fn is called from the read loop, so it must not
+// block or send commands itself.
+func (c *Conn) OnEvent(fn func(Event)) (remove func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.nextID
+	c.nextID++
+	c.handlers = append(c.handlers, eventHandler{id: id, fn: fn})
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.handlers = slices.DeleteFunc(c.handlers, func(h eventHandler) bool { return h.id == id })
+	}
+}
+
+// Sends a command and waits for its response, which is unmarshaled into result unless it is nil.
+func (c *Conn) Call(ctx context.Context, method string, params any, result any) error {
+	if params == nil {
+		params = struct{}{}
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	id := c.nextID
+	c.nextID++
+	ch := make(chan message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	data, err := json.Marshal(command{ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	err = wsutil.WriteClientText(c.rw, data)
+	c.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	case msg, ok := <-ch:
+		if !ok {
+			return ErrClosed
+		}
+		if msg.Type == "error" {
+			return &msg.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+// Closes the connection, pending commands fail with ErrClosed.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	return c.conn.Close()
+}
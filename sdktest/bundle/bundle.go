@@ -0,0 +1,160 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package bundle reports on the size and load cost of the bundles in the dist folder, see `sdktest bundle-report`.
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+)
+
+// The globs of the dist entries, relative to the dist folder. The type declarations and docs are in subfolders of
+// their own and aren't shipped to browsers.
+var entryGlobs = []string{"*.js", "*.cjs", "contrib/*.js"}
+
+// A file in the dist folder and its sizes in bytes.
+type Entry struct {
+	// Relative to the dist folder with forward slashes, e.g. `contrib/recaptcha-site.min.js`.
+	Name   string `json:"name"`
+	Raw    int64  `json:"raw"`
+	Gzip   int64  `json:"gzip"`
+	Brotli int64  `json:"brotli"`
+
+	// The cost of loading the script in the browser, only measured for classic scripts with `--timing`.
+	LoadCost *LoadCost `json:"loadCost,omitempty"`
+	// The budgets it exceeds.
+	Exceeded []string `json:"exceeded,omitempty"`
+}
+
+// Whether the entry is a classic script that pages load with a script tag, rather than an ES or CommonJS module.
+func (e Entry) isClassicScript() bool {
+	base := path.Base(e.Name)
+	return strings.HasSuffix(base, ".js") && !strings.HasPrefix(base, "sdk.")
+}
+
+// The entries of the dist folder, sorted by name.
+func findEntries(distFolder string) ([]string, error) {
+	names := make([]string, 0)
+	for _, glob := range entryGlobs {
+		matches, err := filepath.Glob(filepath.Join(distFolder, filepath.FromSlash(glob)))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(distFolder, m)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Compresses the data the way a CDN would serve it, at the highest compression level.
+func compressedSizes(data []byte) (gz int64, br int64, err error) {
+	var buf bytes.Buffer
+	gw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := gw.Write(data); err != nil {
+		return 0, 0, err
+	}
+	if err := gw.Close(); err != nil {
+		return 0, 0, err
+	}
+	gz = int64(buf.Len())
+
+	buf.Reset()
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := bw.Write(data); err != nil {
+		return 0, 0, err
+	}
+	if err := bw.Close(); err != nil {
+		return 0, 0, err
+	}
+	return gz, int64(buf.Len()), nil
+}
+
+// Measures the sizes of the entries of the dist folder.
+func measureSizes(distFolder string) ([]Entry, error) {
+	names, err := findEntries(distFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(distFolder, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		gz, br, err := compressedSizes(data)
+		if err != nil {
+			return nil, fmt.Errorf("compressing %s: %w", name, err)
+		}
+		entries = append(entries, Entry{
+			Name:   name,
+			Raw:    int64(len(data)),
+			Gzip:   gz,
+			Brotli: br,
+		})
+	}
+	return entries, nil
+}
+
+// Checks the entries against the budgets, an entry can be subject to several of them. Returns an error for budgets
+// with an invalid glob.
+func checkBudgets(entries []Entry, budgets []config.BundleBudget) error {
+	for i := range entries {
+		e := &entries[i]
+		for _, b := range budgets {
+			ok, err := path.Match(b.Files, e.Name)
+			if err != nil {
+				return fmt.Errorf("invalid files glob %q of a budget: %w", b.Files, err)
+			}
+			if !ok {
+				continue
+			}
+
+			for _, size := range []struct {
+				kind   string
+				size   int64
+				budget int64
+			}{
+				{"raw", e.Raw, b.Raw},
+				{"gzip", e.Gzip, b.Gzip},
+				{"brotli", e.Brotli, b.Brotli},
+			} {
+				if size.budget > 0 && size.size > size.budget {
+					e.Exceeded = append(e.Exceeded, fmt.Sprintf(
+						"%s size %s exceeds the budget of %s (%s)",
+						size.kind, formatBytes(size.size), formatBytes(size.budget), b.Files,
+					))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func formatBytes(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/knadh/koanf/v2"
+)
+
+// Exit codes of `sdktest bundle-report`.
+const (
+	ExitOK = 0
+	// One or more entries exceed their budget.
+	ExitOverBudget = 1
+	// The dist folder couldn't be read or the scripts couldn't be loaded in the browser.
+	ExitError = 2
+)
+
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	os.Exit(ExitError)
+}
+
+// The report printed (or written as JSON) by `sdktest bundle-report`.
+type Report struct {
+	Dist    string  `json:"dist"`
+	Entries []Entry `json:"entries"`
+	// The number of runs the load cost is the median of, zero if it wasn't measured.
+	Runs int `json:"runs,omitempty"`
+}
+
+func (r Report) OverBudget() bool {
+	for _, e := range r.Entries {
+		if len(e.Exceeded) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Measures the entries of `bundle_report.dist` and checks them against `bundle_report.budgets`. With
+// `bundle_report.timing` set it also measures their load cost in a headless chromium. It exits with ExitOverBudget if
+// any budget is exceeded.
+func Start(k *koanf.Koanf) {
+	distFolder := "../dist"
+	if k.String("bundle_report.dist") != "" {
+		distFolder = k.String("bundle_report.dist")
+	}
+
+	var budgets []config.BundleBudget
+	if err := k.Unmarshal("bundle_report.budgets", &budgets); err != nil {
+		fatalf("Failed to read bundle_report.budgets: %v", err)
+	}
+
+	entries, err := measureSizes(distFolder)
+	if err != nil {
+		fatalf("Failed to measure the dist entries: %v", err)
+	}
+	if len(entries) == 0 {
+		fatalf("No dist entries found in %s, run the build first", distFolder)
+	}
+	if err := checkBudgets(entries, budgets); err != nil {
+		fatalf("%v", err)
+	}
+
+	report := Report{Dist: distFolder, Entries: entries}
+	if k.Bool("bundle_report.timing") {
+		report.Runs = 5
+		if k.Exists("bundle_report.runs") {
+			report.Runs = k.Int("bundle_report.runs")
+		}
+		if report.Runs < 1 {
+			fatalf("bundle_report.runs must be at least 1")
+		}
+		if err := measureLoadCost(distFolder, report.Entries, report.Runs, k.String("autotest.browser_exec_path")); err != nil {
+			fatalf("Failed to measure the load cost: %v", err)
+		}
+	}
+
+	switch format := k.String("bundle_report.format"); format {
+	case "", "text":
+		report.Print(color.Output)
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fatalf("Failed to write the report: %v", err)
+		}
+	default:
+		fatalf("Unknown bundle_report.format %q, expected text or json", format)
+	}
+
+	if report.OverBudget() {
+		os.Exit(ExitOverBudget)
+	}
+	os.Exit(ExitOK)
+}
+
+func formatMs(ms float64) string {
+	return fmt.Sprintf("%.2fms", ms)
+}
+
+// Prints the report as a table, with the sizes over budget in red.
+func (r Report) Print(out io.Writer) {
+	fmt.Fprintf(out, "%s %s\n\n", color.HiBlackString("dist:"), r.Dist)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "FILE\tRAW\tGZIP\tBROTLI"
+	if r.Runs > 0 {
+		header += "\tPARSE\tEXECUTE"
+	}
+	fmt.Fprintln(tw, header)
+	for _, e := range r.Entries {
+		name := e.Name
+		if len(e.Exceeded) > 0 {
+			name = color.RedString(name)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s", name, formatBytes(e.Raw), formatBytes(e.Gzip), formatBytes(e.Brotli))
+		if r.Runs > 0 {
+			if e.LoadCost != nil {
+				fmt.Fprintf(tw, "\t%s\t%s", formatMs(e.LoadCost.ParseMs), formatMs(e.LoadCost.ExecuteMs))
+			} else {
+				fmt.Fprintf(tw, "\t-\t-")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	if r.Runs > 0 {
+		fmt.Fprintf(out, "\n%s\n", color.HiBlackString(fmt.Sprintf("Load cost is the median of %d runs in headless chromium, modules aren't measured.", r.Runs)))
+	}
+
+	exceeded := 0
+	for _, e := range r.Entries {
+		for _, msg := range e.Exceeded {
+			if exceeded == 0 {
+				fmt.Fprintf(out, "\n%s\n", color.RedString("Over budget:"))
+			}
+			exceeded++
+			fmt.Fprintf(out, "  %s: %s\n", e.Name, msg)
+		}
+	}
+
+	if exceeded > 0 {
+		fmt.Fprintf(out, "\n%s\n", color.RedString(fmt.Sprintf("%d budgets exceeded", exceeded)))
+	} else {
+		fmt.Fprintf(out, "\n%s\n", color.CyanString("All entries within budget"))
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/chromedp/chromedp"
+)
+
+// The time it takes a headless chromium to load a script, as the median of a number of runs.
+type LoadCost struct {
+	// Compiling the script without running it.
+	ParseMs float64 `json:"parseMs"`
+	// Running the script, the time it takes to parse and run it minus the parse time.
+	ExecuteMs float64 `json:"executeMs"`
+}
+
+// Parses the script with the Function constructor, then runs it as an inline script. Errors thrown by an inline
+// script don't propagate to appendChild, they are caught with an error listener.
+const measureScriptJS = `function(src) {
+	let error = "";
+	window.addEventListener("error", (e) => { error = e.message; });
+
+	const t0 = performance.now();
+	new Function(src);
+	const t1 = performance.now();
+	const script = document.createElement("script");
+	script.textContent = src;
+	document.head.appendChild(script);
+	const t2 = performance.now();
+
+	return { parseMs: t1 - t0, totalMs: t2 - t1, error };
+}`
+
+type scriptMeasurement struct {
+	ParseMs float64 `json:"parseMs"`
+	TotalMs float64 `json:"totalMs"`
+	Error   string  `json:"error"`
+}
+
+// Measures a script once, in a browser context of its own so that no caches are shared between runs.
+func measureScript(allocCtx context.Context, src string) (scriptMeasurement, error) {
+	ctx, cancel := chromedp.NewContext(allocCtx, chromedp.WithNewBrowserContext())
+	defer cancel()
+
+	var m scriptMeasurement
+	err := chromedp.Run(ctx,
+		chromedp.Navigate("about:blank"),
+		chromedp.CallFunctionOn(measureScriptJS, &m, nil, src),
+	)
+	if err != nil {
+		return m, err
+	}
+	if m.Error != "" {
+		return m, errors.New(m.Error)
+	}
+	return m, nil
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Measures the load cost of the classic scripts among the entries in a headless chromium, the other entries are
+// modules that aren't loaded by a script tag.
+func measureLoadCost(distFolder string, entries []Entry, runs int, execPath string) error {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.Headless)
+	if execPath != "" {
+		opts = append(opts, chromedp.ExecPath(execPath))
+	}
+	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	defer cancel()
+
+	// Starts the browser, so that its startup isn't part of the first measurement.
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+	if err := chromedp.Run(browserCtx); err != nil {
+		return fmt.Errorf("starting the browser: %w", err)
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		if !e.isClassicScript() {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(distFolder, filepath.FromSlash(e.Name)))
+		if err != nil {
+			return err
+		}
+
+		parse := make([]float64, 0, runs)
+		execute := make([]float64, 0, runs)
+		for range runs {
+			m, err := measureScript(browserCtx, string(src))
+			if err != nil {
+				return fmt.Errorf("loading %s: %w", e.Name, err)
+			}
+			parse = append(parse, m.ParseMs)
+			execute = append(execute, max(0, m.TotalMs-m.ParseMs))
+		}
+		e.LoadCost = &LoadCost{ParseMs: median(parse), ExecuteMs: median(execute)}
+	}
+	return nil
+}
@@ -4,10 +4,168 @@
 // file, You can obtain one at https://mozilla.org/MPL/2.0/.
 package config
 
+import (
+	"slices"
+	"time"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/mockapi"
+)
+
 type Config struct {
 	Sitekey     string            `koanf:"sitekey"`
 	APIEndpoint string            `koanf:"api_endpoint"`
 	Language    string            `koanf:"language"`
 	Port        string            `koanf:"port"`
 	Headers     map[string]string `koanf:"headers"`
+	MockAPI     mockapi.Scenario  `koanf:"mock_api"`
+	Meta        Meta              `koanf:"meta"`
+	Network     Network           `koanf:"network"`
+	// Emulation profiles by name, see Profile.
+	Profiles map[string]Profile `koanf:"profiles"`
+	// Names of the profiles the test runs with, overrides `autotest.profiles` when set in the config.yaml of a test.
+	Emulate []string `koanf:"emulate"`
+	// Run the test in the browser context shared by all tests that set this, instead of a fresh incognito one. For tests
+	// that check that state (such as the session of the SDK) persists across pages.
+	SharedBrowserContext bool `koanf:"shared_browser_context"`
+	// How often autotest re-runs the test if it fails, overrides `autotest.retries` when set in the config.yaml of a
+	// test (e.g. `retries: 0` for a test that must pass the first time).
+	Retries *int `koanf:"retries"`
+	// How fast the widgets of the test have to be, checked by autotest.
+	Budgets TimingBudgets `koanf:"budgets"`
+}
+
+// Metadata about a test case, set under `meta` in its config.yaml.
+type Meta struct {
+	// Such as `network`, `compat`, `interactive` or `slow`.
+	Tags        []string `koanf:"tags"`
+	Owner       string   `koanf:"owner"`
+	Description string   `koanf:"description"`
+	// What the test needs in order to pass, such as `noninteractive_sitekey`.
+	Requires []string `koanf:"requires"`
+}
+
+func (m Meta) HasAnyTag(tags []string) bool {
+	for _, t := range tags {
+		if slices.Contains(m.Tags, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Network conditions the browser emulates while running a test, set under `network` in its config.yaml.
+//
+// Example, a slow connection that goes offline after two seconds and comes back after five:
+//
+//	network:
+//	  latency: 400ms
+//	  download_throughput: 50000
+//	  changes:
+//	    - after: 2s
+//	      offline: true
+//	    - after: 5s
+type Network struct {
+	NetworkConditions `koanf:",squash"`
+
+	// Changes to the conditions during the test, each replaces the conditions entirely.
+	Changes []NetworkChange `koanf:"changes"`
+}
+
+type NetworkConditions struct {
+	Offline bool `koanf:"offline"`
+	// Minimum time from sending a request until receiving the response headers.
+	Latency time.Duration `koanf:"latency"`
+	// In bytes per second, zero means unlimited.
+	DownloadThroughput float64 `koanf:"download_throughput"`
+	UploadThroughput   float64 `koanf:"upload_throughput"`
+}
+
+// Whether the conditions are those of an unthrottled connection.
+func (c NetworkConditions) IsZero() bool {
+	return c == NetworkConditions{}
+}
+
+// Whether any emulation is needed at all.
+func (n Network) IsZero() bool {
+	return n.NetworkConditions.IsZero() && len(n.Changes) == 0
+}
+
+type NetworkChange struct {
+	// Time since the test page started loading.
+	After             time.Duration `koanf:"after"`
+	NetworkConditions `koanf:",squash"`
+}
+
+// A device and environment the browser emulates while running a test, defined under `profiles` and selected with
+// `autotest.profiles` or `emulate` in the config.yaml of a test. Zero values keep the browser's defaults.
+//
+// Example:
+//
+//	profiles:
+//	  mobile:
+//	    width: 390
+//	    height: 844
+//	    device_scale_factor: 3
+//	    mobile: true
+//	    touch: true
+//	    user_agent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) ..."
+//	    timezone: "America/New_York"
+//	    locale: "en-US"
+//	    color_scheme: "dark"
+type Profile struct {
+	// Viewport size in CSS pixels.
+	Width             int64   `koanf:"width"`
+	Height            int64   `koanf:"height"`
+	DeviceScaleFactor float64 `koanf:"device_scale_factor"`
+	// Emulates a mobile device: the viewport meta tag is respected, scrollbars overlay the content, etc.
+	Mobile bool `koanf:"mobile"`
+	// Emulates a touch screen, which also makes mouse input dispatch touch events.
+	Touch     bool   `koanf:"touch"`
+	UserAgent string `koanf:"user_agent"`
+	// IANA timezone ID, e.g. "Europe/Berlin".
+	Timezone string `koanf:"timezone"`
+	// ICU locale, e.g. "de-DE", also used for the Accept-Language header.
+	Locale string `koanf:"locale"`
+	// The `prefers-color-scheme` media feature: "light" or "dark".
+	ColorScheme string `koanf:"color_scheme"`
+}
+
+// Limits on how long the widgets of a test may take to get through their lifecycle, set under `budgets` (for all tests
+// in sdktest.yaml, or in the config.yaml of a test). Zero means no limit. Every widget of every page of the test is
+// checked.
+//
+// Example:
+//
+//	budgets:
+//	  widget_ready_ms: 1500
+//	  widget_completed_ms: 8000
+//	  on_exceed: warn
+type TimingBudgets struct {
+	// From the page starting to load until the widget is ready (`unactivated`).
+	WidgetReadyMs int `koanf:"widget_ready_ms"`
+	// From the widget starting (`activating`) until it is `solving`.
+	WidgetSolvingMs int `koanf:"widget_solving_ms"`
+	// From the widget starting (`activating`) until it is `completed`.
+	WidgetCompletedMs int `koanf:"widget_completed_ms"`
+	// "fail" (the default) fails the test when a budget is exceeded, "warn" only reports it.
+	OnExceed string `koanf:"on_exceed"`
+}
+
+// A size budget of `sdktest bundle-report`, set as a list under `bundle_report.budgets`. Zero means no limit.
+//
+// Example:
+//
+//	bundle_report:
+//	  budgets:
+//	    - files: "site.min.js"
+//	      gzip: 25000
+//	    - files: "contrib/*.min.js"
+//	      brotli: 22000
+type BundleBudget struct {
+	// Glob of the dist entries the budget applies to, relative to the dist folder, e.g. `*.compat.min.js`.
+	Files string `koanf:"files"`
+	// Sizes in bytes.
+	Raw    int64 `koanf:"raw"`
+	Gzip   int64 `koanf:"gzip"`
+	Brotli int64 `koanf:"brotli"`
 }
@@ -0,0 +1,375 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package coverage maps the JS coverage of the dist bundles, as collected by autotest, back to the TypeScript sources
+// of the SDK and writes it as lcov and HTML reports.
+package coverage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// The path the sdktest server serves the dist folder on.
+const DistPath = "/static/dist/"
+
+// The coverage of a script, as reported by the Profiler of the Chrome DevTools Protocol with block coverage.
+type Script struct {
+	URL       string
+	Functions []Function
+}
+
+type Function struct {
+	Name string
+	// The first range spans the whole function, the others are blocks within it.
+	Ranges []Range
+}
+
+// A range of a script that ran Count times, the offsets count UTF-16 code units.
+type Range struct {
+	StartOffset int
+	EndOffset   int
+	Count       int
+}
+
+// A position in a source file, the line starts at 1.
+type sourceLine struct {
+	file string
+	line int
+}
+
+// A point of a bundle that maps to a line of a source in `src/`.
+type point struct {
+	offset int
+	sourceLine
+}
+
+// A dist bundle and its source map.
+type bundle struct {
+	// Sorted by offset.
+	points []point
+}
+
+// Merges the coverage of the dist bundles across tests into line coverage of the sources in `src/`. It is safe for
+// concurrent use.
+type Collector struct {
+	distFolder string
+
+	mu sync.Mutex
+	// By path relative to the dist folder, nil for bundles without a source map.
+	bundles map[string]*bundle
+	// The execution counts of the lines of the sources, lines that aren't in there don't contain code.
+	lines map[string]map[int]int
+	// The sources as embedded in the source maps, in case they can't be read from `src/`.
+	contents map[string]string
+	// Problems with the bundles, such as missing source maps, by bundle.
+	problems map[string]string
+}
+
+func NewCollector(distFolder string) *Collector {
+	return &Collector{
+		distFolder: distFolder,
+		bundles:    make(map[string]*bundle),
+		lines:      make(map[string]map[int]int),
+		contents:   make(map[string]string),
+		problems:   make(map[string]string),
+	}
+}
+
+// The path of a dist bundle relative to the dist folder, false if the URL isn't one of a bundle.
+func distName(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.HasPrefix(u.Path, DistPath) {
+		return "", false
+	}
+	name := strings.TrimPrefix(u.Path, DistPath)
+	if !strings.HasSuffix(name, ".js") && !strings.HasSuffix(name, ".cjs") {
+		return "", false
+	}
+	return name, true
+}
+
+// The path of a source of a source map relative to the root of the repository (e.g. `src/sdk/sdk.ts`), false for
+// sources that aren't TypeScript files in `src/` such as dependencies or the polyfills. The bundles are built in
+// `build/bundle/` and copied to `dist/`, so the relative paths in their source maps don't resolve from `dist/`.
+func sourcePath(source string) (string, bool) {
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" {
+		source = u.Path
+	}
+	p := path.Clean(strings.ReplaceAll(source, "\\", "/"))
+	if strings.Contains("/"+p, "/node_modules/") {
+		return "", false
+	}
+	for strings.HasPrefix(p, "../") {
+		p = strings.TrimPrefix(p, "../")
+	}
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.Index(p, "src/"); i > 0 && strings.HasSuffix(p[:i], "/") {
+		// e.g. an absolute path of the machine the bundle was built on.
+		p = p[i:]
+	}
+	ok := strings.HasPrefix(p, "src/") && strings.HasSuffix(p, ".ts")
+	return p, ok
+}
+
+var sourceMappingURLRegexp = regexp.MustCompile(`//# sourceMappingURL=(\S+)\s*$`)
+
+// Reads the source map of a bundle, from its sourceMappingURL comment or else from the `.map` file next to it. Returns
+// nil if it has none.
+func readSourceMap(filename string, code []byte) ([]byte, error) {
+	if m := sourceMappingURLRegexp.FindSubmatch(code); m != nil {
+		ref := string(m[1])
+		if strings.HasPrefix(ref, "data:") {
+			_, data, ok := strings.Cut(ref, ";base64,")
+			if !ok {
+				return nil, errors.New("inline source map isn't base64 encoded")
+			}
+			return base64.StdEncoding.DecodeString(data)
+		}
+		ref, _ = url.PathUnescape(ref)
+		return os.ReadFile(filepath.Join(filepath.Dir(filename), filepath.FromSlash(ref)))
+	}
+
+	data, err := os.ReadFile(filename + ".map")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// The offsets at which the lines of the code start.
+func lineStarts(code []uint16) []int {
+	starts := []int{0}
+	for i, c := range code {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// Moves the offset past the indentation it points at. Mappings often start at the beginning of a line, while the range
+// of a function starts at its `function` keyword.
+func skipIndentation(code []uint16, offset int) int {
+	for offset < len(code) && (code[offset] == ' ' || code[offset] == '\t') {
+		offset++
+	}
+	return offset
+}
+
+// Loads a bundle and its source map, the bundle is nil if it has no source map.
+func (c *Collector) loadBundle(name string) (*bundle, error) {
+	filename := filepath.Join(c.distFolder, filepath.FromSlash(name))
+	code, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readSourceMap(filename, code)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	sm, err := parseSourceMap(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing its source map: %w", err)
+	}
+
+	sources := make([]string, len(sm.sources))
+	for i, source := range sm.sources {
+		p, ok := sourcePath(source)
+		if !ok {
+			continue
+		}
+		sources[i] = p
+		if _, ok := c.contents[p]; !ok && sm.sourcesContent[i] != "" {
+			c.contents[p] = sm.sourcesContent[i]
+		}
+	}
+
+	// The offsets of the coverage count UTF-16 code units.
+	units := utf16.Encode([]rune(string(code)))
+	starts := lineStarts(units)
+	b := &bundle{points: make([]point, 0, len(sm.segments))}
+	for _, s := range sm.segments {
+		if s.source < 0 || sources[s.source] == "" || s.genLine >= len(starts) {
+			continue
+		}
+		b.points = append(b.points, point{
+			offset:     skipIndentation(units, starts[s.genLine]+s.genCol),
+			sourceLine: sourceLine{file: sources[s.source], line: s.srcLine + 1},
+		})
+	}
+	slices.SortStableFunc(b.points, func(a, b point) int { return a.offset - b.offset })
+	return b, nil
+}
+
+// The bundle by its path relative to the dist folder, loaded on first use. The caller holds c.mu.
+func (c *Collector) bundle(name string) *bundle {
+	if b, ok := c.bundles[name]; ok {
+		return b
+	}
+	b, err := c.loadBundle(name)
+	switch {
+	case err != nil:
+		c.problems[name] = err.Error()
+	case b == nil:
+		c.problems[name] = "no source map, build with SOURCEMAPS=1"
+	}
+	c.bundles[name] = b
+	return b
+}
+
+// The count of the innermost range from an offset on, until the start of the next span.
+type span struct {
+	start int
+	// -1 outside of any range.
+	count int
+}
+
+// Flattens the nested ranges of a script into consecutive spans with the count of the innermost range.
+func flatten(functions []Function) []span {
+	ranges := make([]Range, 0)
+	for _, f := range functions {
+		ranges = append(ranges, f.Ranges...)
+	}
+	slices.SortFunc(ranges, func(a, b Range) int {
+		if a.StartOffset != b.StartOffset {
+			return a.StartOffset - b.StartOffset
+		}
+		return b.EndOffset - a.EndOffset
+	})
+
+	spans := make([]span, 0, len(ranges)*2)
+	emit := func(start, count int) {
+		if n := len(spans); n > 0 && spans[n-1].start == start {
+			spans[n-1].count = count
+			return
+		}
+		spans = append(spans, span{start, count})
+	}
+
+	stack := make([]Range, 0)
+	pop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		count := -1
+		if len(stack) > 0 {
+			count = stack[len(stack)-1].Count
+		}
+		emit(top.EndOffset, count)
+	}
+	for _, r := range ranges {
+		for len(stack) > 0 && stack[len(stack)-1].EndOffset <= r.StartOffset {
+			pop()
+		}
+		if len(stack) > 0 {
+			// Ranges nest, but keep the spans in order if they don't.
+			r.EndOffset = min(r.EndOffset, stack[len(stack)-1].EndOffset)
+		}
+		stack = append(stack, r)
+		emit(r.StartOffset, r.Count)
+	}
+	for len(stack) > 0 {
+		pop()
+	}
+	return spans
+}
+
+func countAt(spans []span, offset int) int {
+	i, found := slices.BinarySearchFunc(spans, offset, func(s span, offset int) int { return s.start - offset })
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return -1
+	}
+	return spans[i].count
+}
+
+// Adds the coverage of the scripts of a test page, scripts that aren't dist bundles are ignored.
+func (c *Collector) Add(scripts []Script) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, script := range scripts {
+		name, ok := distName(script.URL)
+		if !ok {
+			continue
+		}
+		b := c.bundle(name)
+		if b == nil {
+			continue
+		}
+
+		// A line counts as often as the code on it that ran most often.
+		spans := flatten(script.Functions)
+		counts := make(map[sourceLine]int)
+		for _, p := range b.points {
+			count := countAt(spans, p.offset)
+			if count < 0 {
+				continue
+			}
+			if current, ok := counts[p.sourceLine]; !ok || count > current {
+				counts[p.sourceLine] = count
+			}
+		}
+
+		for sl, count := range counts {
+			c.addLine(sl, count)
+		}
+	}
+}
+
+// The caller holds c.mu.
+func (c *Collector) addLine(sl sourceLine, count int) {
+	lines, ok := c.lines[sl.file]
+	if !ok {
+		lines = make(map[int]int)
+		c.lines[sl.file] = lines
+	}
+	lines[sl.line] += count
+}
+
+// The globs of the bundles in the dist folder, relative to it.
+var bundleGlobs = []string{"*.js", "*.cjs", "contrib/*.js"}
+
+// Adds the lines of all bundles in the dist folder with a count of zero, so that sources of bundles that no test loaded
+// are reported as not covered rather than left out. The caller holds c.mu.
+func (c *Collector) addAllBundles() {
+	for _, glob := range bundleGlobs {
+		matches, _ := filepath.Glob(filepath.Join(c.distFolder, filepath.FromSlash(glob)))
+		for _, m := range matches {
+			rel, err := filepath.Rel(c.distFolder, m)
+			if err != nil {
+				continue
+			}
+			name := filepath.ToSlash(rel)
+			b, loaded := c.bundles[name]
+			if !loaded {
+				// A bundle without a source map is only a problem if a test loaded it.
+				var err error
+				if b, err = c.loadBundle(name); err != nil {
+					c.problems[name] = err.Error()
+				}
+				c.bundles[name] = b
+			}
+			if b == nil {
+				continue
+			}
+			for _, p := range b.points {
+				c.addLine(p.sourceLine, 0)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package coverage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFlattenCountAt(t *testing.T) {
+	tests := []struct {
+		name      string
+		functions []Function
+		// Offset to the expected count.
+		want map[int]int
+	}{
+		{
+			name:      "single range",
+			functions: []Function{{Ranges: []Range{{0, 100, 1}}}},
+			want:      map[int]int{-1: -1, 0: 1, 50: 1, 99: 1, 100: -1, 200: -1},
+		},
+		{
+			name: "inner blocks override the count of the function",
+			functions: []Function{{Ranges: []Range{
+				{0, 100, 4},
+				{10, 20, 0},
+				{60, 80, 2},
+				{65, 70, 0},
+			}}},
+			want: map[int]int{0: 4, 9: 4, 10: 0, 19: 0, 20: 4, 60: 2, 64: 2, 65: 0, 69: 0, 70: 2, 80: 4, 99: 4},
+		},
+		{
+			name: "nested functions, reported before the script they are in",
+			functions: []Function{
+				{Name: "b", Ranges: []Range{{30, 60, 5}, {40, 50, 0}}},
+				{Name: "a", Ranges: []Range{{10, 20, 0}}},
+				{Ranges: []Range{{0, 100, 1}}},
+			},
+			want: map[int]int{0: 1, 10: 0, 20: 1, 29: 1, 30: 5, 39: 5, 40: 0, 50: 5, 59: 5, 60: 1, 99: 1, 100: -1},
+		},
+		{
+			name: "ranges with the same start, the shorter one is inside the other",
+			functions: []Function{{Ranges: []Range{
+				{0, 50, 3},
+				{0, 100, 1},
+			}}},
+			want: map[int]int{0: 3, 49: 3, 50: 1, 99: 1},
+		},
+		{
+			name: "ranges ending at the same offset",
+			functions: []Function{{Ranges: []Range{
+				{0, 100, 1},
+				{50, 100, 0},
+			}}},
+			want: map[int]int{49: 1, 50: 0, 99: 0, 100: -1},
+		},
+		{
+			name: "adjacent ranges",
+			functions: []Function{{Ranges: []Range{
+				{0, 10, 1},
+				{10, 20, 2},
+			}}},
+			want: map[int]int{0: 1, 9: 1, 10: 2, 19: 2, 20: -1},
+		},
+		{
+			name: "overlapping ranges are cut off at the end of the outer one",
+			functions: []Function{{Ranges: []Range{
+				{0, 50, 1},
+				{40, 80, 2},
+			}}},
+			want: map[int]int{39: 1, 40: 2, 49: 2, 50: -1, 79: -1},
+		},
+		{
+			name: "gaps between functions",
+			functions: []Function{
+				{Ranges: []Range{{10, 20, 1}}},
+				{Ranges: []Range{{30, 40, 0}}},
+			},
+			want: map[int]int{0: -1, 10: 1, 20: -1, 29: -1, 30: 0, 40: -1},
+		},
+		{
+			name:      "no ranges",
+			functions: nil,
+			want:      map[int]int{0: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := flatten(tt.functions)
+			for i := 1; i < len(spans); i++ {
+				if spans[i].start <= spans[i-1].start {
+					t.Fatalf("spans aren't in order: %v", spans)
+				}
+			}
+			for _, offset := range slices.Sorted(func(yield func(int) bool) {
+				for o := range tt.want {
+					if !yield(o) {
+						return
+					}
+				}
+			}) {
+				if got := countAt(spans, offset); got != tt.want[offset] {
+					t.Errorf("countAt(%d) = %d, want %d (spans %v)", offset, got, tt.want[offset], spans)
+				}
+			}
+		})
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+		ok     bool
+	}{
+		{"../../src/sdk/dom.ts", "src/sdk/dom.ts", true},
+		{"../../../src/compat/hcaptcha.ts", "src/compat/hcaptcha.ts", true},
+		{"src/util/url.ts", "src/util/url.ts", true},
+		{"/home/ci/sdk/src/sdk/sdk.ts", "src/sdk/sdk.ts", true},
+		{"file:///home/ci/sdk/src/sdk/sdk.ts", "src/sdk/sdk.ts", true},
+		{"../../node_modules/some/src/index.ts", "", false},
+		{"../../src/polyfill/polyfills.min.js", "", false},
+		{"../../test/a.ts", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := sourcePath(tt.source)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("sourcePath(%q) = %q, %v, want %q, %v", tt.source, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	dist := filepath.Join(t.TempDir(), "dist")
+	if err := os.MkdirAll(filepath.Join(dist, "contrib"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// The second function is indented, its line's mapping starts before its range does.
+	code := "function a() {\n  return 1;\n}\n  function b() {\n  return 2;\n}\n"
+	sourceMap := `{"version":3,"sources":["../../src/x.ts"],"mappings":"AAAA;AACA;AACA;AACA;AACA;AACA"}`
+	files := map[string]string{
+		"site.js":                      code + "//# sourceMappingURL=site.js.map\n",
+		"site.js.map":                  sourceMap,
+		"contrib/hcaptcha-site.js":     code,
+		"contrib/hcaptcha-site.js.map": strings.Replace(sourceMap, "src/x.ts", "src/compat/hcaptcha.ts", 1),
+		"polyfills.min.js":             "var p;\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dist, filepath.FromSlash(name)), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := strings.Index(code, "function b")
+	script := Script{
+		URL: "http://localhost:8912" + DistPath + "site.js",
+		Functions: []Function{
+			{Ranges: []Range{{0, len(code), 1}}},
+			{Name: "a", Ranges: []Range{{0, b - 3, 3}}},
+			{Name: "b", Ranges: []Range{{b, len(code) - 1, 0}}},
+		},
+	}
+	c := NewCollector(dist)
+	c.Add([]Script{script, {URL: "http://localhost:8912/scripts/sdktestlib.js"}})
+	c.Add([]Script{script, {URL: "http://localhost:8912" + DistPath + "polyfills.min.js"}})
+
+	r := c.Report()
+	want := []File{
+		{Path: "src/compat/hcaptcha.ts", Lines: []Line{{1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 0}}},
+		{Path: "src/x.ts", Lines: []Line{{1, 6}, {2, 6}, {3, 6}, {4, 0}, {5, 0}, {6, 0}}, Hit: 3},
+	}
+	if len(r.Files) != len(want) {
+		t.Fatalf("files = %v, want %v", r.Files, want)
+	}
+	for i := range want {
+		if r.Files[i].Path != want[i].Path || r.Files[i].Hit != want[i].Hit || !slices.Equal(r.Files[i].Lines, want[i].Lines) {
+			t.Errorf("file %d = %v, want %v", i, r.Files[i], want[i])
+		}
+	}
+
+	// Only the bundle without a source map that ran is a problem.
+	if _, ok := r.Problems["polyfills.min.js"]; !ok || len(r.Problems) != 1 {
+		t.Errorf("problems = %v, want one for polyfills.min.js", r.Problems)
+	}
+}
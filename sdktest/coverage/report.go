@@ -0,0 +1,222 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package coverage
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"html/template"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+//go:embed *.tmpl.html
+var embedFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"percent": func(hit, total int) string { return formatPercent(hit, total) },
+}).ParseFS(embedFS, "*.tmpl.html"))
+
+// The file names of the reports within the coverage folder.
+const (
+	LcovFileName = "lcov.info"
+	HTMLFileName = "index.html"
+)
+
+// The line coverage of a source file.
+type File struct {
+	// Relative to the root of the repository, e.g. `src/compat/hcaptcha.ts`.
+	Path string
+	// The lines that contain code, sorted.
+	Lines []Line
+	// The number of lines that ran.
+	Hit int
+}
+
+type Line struct {
+	Number int
+	Count  int
+}
+
+// The coverage of the SDK sources across all tests.
+type Report struct {
+	Files []File
+	// Why the coverage of some bundles couldn't be mapped to the sources, by bundle.
+	Problems map[string]string
+}
+
+func (r Report) Lines() (hit int, total int) {
+	for _, f := range r.Files {
+		hit += f.Hit
+		total += len(f.Lines)
+	}
+	return hit, total
+}
+
+func formatPercent(hit, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(hit)/float64(total)*100)
+}
+
+// The coverage collected so far, including the sources of bundles that no test loaded.
+func (c *Collector) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addAllBundles()
+	r := Report{Problems: maps.Clone(c.problems)}
+	for _, p := range slices.Sorted(maps.Keys(c.lines)) {
+		f := File{Path: p}
+		for _, n := range slices.Sorted(maps.Keys(c.lines[p])) {
+			count := c.lines[p][n]
+			f.Lines = append(f.Lines, Line{Number: n, Count: count})
+			if count > 0 {
+				f.Hit++
+			}
+		}
+		r.Files = append(r.Files, f)
+	}
+	return r
+}
+
+// The root of the repository, which holds the dist folder and `src/`.
+func (c *Collector) root() string {
+	return filepath.Dir(filepath.Clean(c.distFolder))
+}
+
+// The contents of a source, read from `src/` or else taken from the source maps.
+func (c *Collector) source(p string) string {
+	if data, err := os.ReadFile(filepath.Join(c.root(), filepath.FromSlash(p))); err == nil {
+		return string(data)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.contents[p]
+}
+
+// Writes the coverage collected so far to dir, as `lcov.info` and as an HTML report with `index.html` as its entry.
+func (c *Collector) Write(dir string) (Report, error) {
+	r := c.Report()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return r, err
+	}
+	if err := c.writeLcov(filepath.Join(dir, LcovFileName), r); err != nil {
+		return r, err
+	}
+	return r, c.writeHTML(dir, r)
+}
+
+func (c *Collector) writeLcov(filename string, r Report) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	root, err := filepath.Abs(c.root())
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, file := range r.Files {
+		fmt.Fprintf(w, "TN:\nSF:%s\n", filepath.Join(root, filepath.FromSlash(file.Path)))
+		for _, l := range file.Lines {
+			fmt.Fprintf(w, "DA:%d,%d\n", l.Number, l.Count)
+		}
+		fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(file.Lines), file.Hit)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+type indexTemplateData struct {
+	Files    []File
+	Hit      int
+	Total    int
+	Problems map[string]string
+}
+
+type sourceLineData struct {
+	Number int
+	Code   string
+	// "hit", "miss" or empty for lines without code.
+	Class string
+	Count int
+}
+
+type fileTemplateData struct {
+	File File
+	// Relative path from the page of the file to the index.
+	Index string
+	Lines []sourceLineData
+}
+
+func (c *Collector) writeHTML(dir string, r Report) error {
+	hit, total := r.Lines()
+	if err := writeTemplate(filepath.Join(dir, HTMLFileName), "index.tmpl.html", indexTemplateData{
+		Files:    r.Files,
+		Hit:      hit,
+		Total:    total,
+		Problems: r.Problems,
+	}); err != nil {
+		return err
+	}
+
+	for _, f := range r.Files {
+		counts := make(map[int]int, len(f.Lines))
+		for _, l := range f.Lines {
+			counts[l.Number] = l.Count
+		}
+
+		code := strings.Split(strings.ReplaceAll(c.source(f.Path), "\r\n", "\n"), "\n")
+		lines := make([]sourceLineData, 0, len(code))
+		for i, text := range code {
+			l := sourceLineData{Number: i + 1, Code: text}
+			if count, ok := counts[l.Number]; ok {
+				l.Count = count
+				l.Class = "miss"
+				if count > 0 {
+					l.Class = "hit"
+				}
+			}
+			lines = append(lines, l)
+		}
+
+		page := filepath.Join(dir, filepath.FromSlash(f.Path)+".html")
+		if err := os.MkdirAll(filepath.Dir(page), 0o755); err != nil {
+			return err
+		}
+		if err := writeTemplate(page, "file.tmpl.html", fileTemplateData{
+			File:  f,
+			Index: strings.Repeat("../", strings.Count(f.Path, "/")) + HTMLFileName,
+			Lines: lines,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTemplate(filename string, name string, data any) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := templates.ExecuteTemplate(f, name, data); err != nil {
+		return fmt.Errorf("rendering %s: %w", filename, err)
+	}
+	return f.Close()
+}
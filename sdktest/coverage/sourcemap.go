@@ -0,0 +1,167 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package coverage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// A mapping of a source map, from a position in the generated file to one in a source. Lines and columns start at
+// zero, columns count UTF-16 code units.
+type segment struct {
+	genLine, genCol int
+	// Index into sourceMap.sources, -1 if the segment doesn't map to a source.
+	source          int
+	srcLine, srcCol int
+}
+
+// A parsed source map (version 3), index maps with sections are flattened.
+type sourceMap struct {
+	sources []string
+	// The contents of the sources if the map embeds them, empty strings otherwise.
+	sourcesContent []string
+	// Sorted by generated position.
+	segments []segment
+}
+
+type rawSourceMap struct {
+	Version        int       `json:"version"`
+	SourceRoot     string    `json:"sourceRoot"`
+	Sources        []string  `json:"sources"`
+	SourcesContent []*string `json:"sourcesContent"`
+	Mappings       string    `json:"mappings"`
+	Sections       []struct {
+		Offset struct {
+			Line   int `json:"line"`
+			Column int `json:"column"`
+		} `json:"offset"`
+		Map *rawSourceMap `json:"map"`
+	} `json:"sections"`
+}
+
+func parseSourceMap(data []byte) (*sourceMap, error) {
+	var raw rawSourceMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	sm := &sourceMap{}
+	if err := sm.add(&raw, 0, 0); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// Adds the mappings of raw to the map, moved down by the offset of its section.
+func (sm *sourceMap) add(raw *rawSourceMap, lineOffset, colOffset int) error {
+	if raw.Version != 3 {
+		return fmt.Errorf("unsupported source map version %d", raw.Version)
+	}
+
+	if len(raw.Sections) > 0 {
+		for _, section := range raw.Sections {
+			if section.Map == nil {
+				return errors.New("source map sections with a url aren't supported")
+			}
+			if err := sm.add(section.Map, lineOffset+section.Offset.Line, section.Offset.Column); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	first := len(sm.sources)
+	for i, source := range raw.Sources {
+		if raw.SourceRoot != "" {
+			source = path.Join(raw.SourceRoot, source)
+		}
+		sm.sources = append(sm.sources, source)
+		content := ""
+		if i < len(raw.SourcesContent) && raw.SourcesContent[i] != nil {
+			content = *raw.SourcesContent[i]
+		}
+		sm.sourcesContent = append(sm.sourcesContent, content)
+	}
+
+	segments, err := decodeMappings(raw.Mappings, len(raw.Sources))
+	if err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if s.genLine == 0 {
+			s.genCol += colOffset
+		}
+		s.genLine += lineOffset
+		if s.source >= 0 {
+			s.source += first
+		}
+		sm.segments = append(sm.segments, s)
+	}
+	return nil
+}
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// Decodes the base64 VLQ encoded mappings of a source map.
+func decodeMappings(mappings string, numSources int) ([]segment, error) {
+	segments := make([]segment, 0, len(mappings)/4)
+	var source, srcLine, srcCol int
+	for genLine, line := range strings.Split(mappings, ";") {
+		genCol := 0
+		for _, field := range strings.Split(line, ",") {
+			if field == "" {
+				continue
+			}
+			values, err := decodeVLQ(field)
+			if err != nil {
+				return nil, err
+			}
+
+			genCol += values[0]
+			s := segment{genLine: genLine, genCol: genCol, source: -1}
+			if len(values) >= 4 {
+				source += values[1]
+				srcLine += values[2]
+				srcCol += values[3]
+				if source < 0 || source >= numSources {
+					return nil, fmt.Errorf("mapping refers to source %d of %d", source, numSources)
+				}
+				s.source, s.srcLine, s.srcCol = source, srcLine, srcCol
+			}
+			segments = append(segments, s)
+		}
+	}
+	return segments, nil
+}
+
+func decodeVLQ(field string) ([]int, error) {
+	values := make([]int, 0, 5)
+	value, shift := 0, 0
+	for i := 0; i < len(field); i++ {
+		digit := strings.IndexByte(base64Alphabet, field[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base64 character %q in mappings", field[i])
+		}
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+	if shift != 0 || len(values) == 0 {
+		return nil, fmt.Errorf("truncated mapping %q", field)
+	}
+	return values, nil
+}
@@ -0,0 +1,190 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package coverage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDecodeVLQ(t *testing.T) {
+	tests := []struct {
+		field   string
+		want    []int
+		wantErr bool
+	}{
+		{field: "A", want: []int{0}},
+		{field: "C", want: []int{1}},
+		{field: "D", want: []int{-1}},
+		{field: "P", want: []int{-7}},
+		// 16 doesn't fit into the 4 value bits of a single digit, so it continues into a second one.
+		{field: "gB", want: []int{16}},
+		{field: "hB", want: []int{-16}},
+		{field: "2H", want: []int{123}},
+		{field: "ggggC", want: []int{1 << 20}},
+		{field: "AAgBC", want: []int{0, 0, 16, 1}},
+		{field: "AACD", want: []int{0, 0, 1, -1}},
+		// A continuation bit without a following digit.
+		{field: "g", wantErr: true},
+		{field: "Ag", wantErr: true},
+		{field: "A!", wantErr: true},
+		{field: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := decodeVLQ(tt.field)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("decodeVLQ(%q) = %v, want an error", tt.field, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("decodeVLQ(%q) = %v, %v, want %v", tt.field, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeMappings(t *testing.T) {
+	tests := []struct {
+		name       string
+		mappings   string
+		numSources int
+		want       []segment
+		wantErr    bool
+	}{
+		{
+			name:       "source positions are relative to the previous segment, also across lines",
+			mappings:   "AAAA,EAAE;AACA",
+			numSources: 1,
+			want: []segment{
+				{genLine: 0, genCol: 0, source: 0, srcLine: 0, srcCol: 0},
+				{genLine: 0, genCol: 2, source: 0, srcLine: 0, srcCol: 2},
+				{genLine: 1, genCol: 0, source: 0, srcLine: 1, srcCol: 2},
+			},
+		},
+		{
+			name:       "generated columns start over on every line",
+			mappings:   "IAAI;;IACA,CAAC",
+			numSources: 1,
+			want: []segment{
+				{genLine: 0, genCol: 4, source: 0, srcLine: 0, srcCol: 4},
+				{genLine: 2, genCol: 4, source: 0, srcLine: 1, srcCol: 4},
+				{genLine: 2, genCol: 5, source: 0, srcLine: 1, srcCol: 5},
+			},
+		},
+		{
+			name:       "negative deltas and switching sources",
+			mappings:   "AAKA,CCDA,CDAA",
+			numSources: 2,
+			want: []segment{
+				{genLine: 0, genCol: 0, source: 0, srcLine: 5, srcCol: 0},
+				{genLine: 0, genCol: 1, source: 1, srcLine: 4, srcCol: 0},
+				{genLine: 0, genCol: 2, source: 0, srcLine: 4, srcCol: 0},
+			},
+		},
+		{
+			name:       "segments without a source",
+			mappings:   "A,CAAA",
+			numSources: 1,
+			want: []segment{
+				{genLine: 0, genCol: 0, source: -1},
+				{genLine: 0, genCol: 1, source: 0, srcLine: 0, srcCol: 0},
+			},
+		},
+		{
+			name:       "source out of range",
+			mappings:   "ACAA",
+			numSources: 1,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMappings(tt.mappings, tt.numSources)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeMappings(%q) = %v, want an error", tt.mappings, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("decodeMappings(%q) =\n%v\nwant\n%v", tt.mappings, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSourceMapSections(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantSources []string
+		want        []segment
+	}{
+		{
+			// The shape of the maps of the compat bundles, see `add_polyfills` in build.sh.
+			name: "section moved down by the lines of the polyfills",
+			data: `{"version":3,"file":"site.compat.js","sections":[{"offset":{"line":7,"column":0},"map":
+				{"version":3,"sources":["../../src/sdk/dom.ts"],"mappings":"AAAA;EACE"}}]}`,
+			wantSources: []string{"../../src/sdk/dom.ts"},
+			want: []segment{
+				{genLine: 7, genCol: 0, source: 0, srcLine: 0, srcCol: 0},
+				{genLine: 8, genCol: 2, source: 0, srcLine: 1, srcCol: 2},
+			},
+		},
+		{
+			name: "column offset only applies to the first line of a section",
+			data: `{"version":3,"sections":[{"offset":{"line":0,"column":10},"map":
+				{"version":3,"sources":["a.ts"],"mappings":"AAAA,CAAC;AACA"}}]}`,
+			wantSources: []string{"a.ts"},
+			want: []segment{
+				{genLine: 0, genCol: 10, source: 0, srcLine: 0, srcCol: 0},
+				{genLine: 0, genCol: 11, source: 0, srcLine: 0, srcCol: 1},
+				{genLine: 1, genCol: 0, source: 0, srcLine: 1, srcCol: 1},
+			},
+		},
+		{
+			name: "sources of later sections come after those of earlier ones",
+			data: `{"version":3,"sections":[
+				{"offset":{"line":0,"column":0},"map":{"version":3,"sources":["a.ts"],"mappings":"AAAA"}},
+				{"offset":{"line":3,"column":0},"map":{"version":3,"sourceRoot":"src","sources":["b.ts"],"mappings":"AAAC"}}]}`,
+			wantSources: []string{"a.ts", "src/b.ts"},
+			want: []segment{
+				{genLine: 0, genCol: 0, source: 0, srcLine: 0, srcCol: 0},
+				{genLine: 3, genCol: 0, source: 1, srcLine: 0, srcCol: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, err := parseSourceMap([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(sm.sources, tt.wantSources) {
+				t.Errorf("sources = %v, want %v", sm.sources, tt.wantSources)
+			}
+			if !slices.Equal(sm.segments, tt.want) {
+				t.Errorf("segments =\n%v\nwant\n%v", sm.segments, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSourceMapErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"version":2,"sources":[],"mappings":""}`,
+		`{"version":3,"sections":[{"offset":{"line":0,"column":0},"url":"other.map"}]}`,
+		`{"version":3,"sources":["a.ts"],"mappings":"AAAA,g"}`,
+		`not json`,
+	} {
+		if _, err := parseSourceMap([]byte(data)); err == nil {
+			t.Errorf("parseSourceMap(%s) succeeded, want an error", data)
+		}
+	}
+}
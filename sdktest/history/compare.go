@@ -0,0 +1,174 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package history
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// A test of the baseline, the timings are the medians of the runs the test was in.
+type baselineTest struct {
+	Test
+	// The status in the most recent of the runs.
+	LastStatus string
+}
+
+// What the latest run is compared against: a single run, or the medians of several.
+type Baseline struct {
+	// IDs of the runs, oldest first.
+	Runs  []string
+	tests map[string]baselineTest
+}
+
+// The baseline of the runs, oldest first. The runs should be in the same browser as the run they are compared against.
+func NewBaseline(runs []Run) Baseline {
+	b := Baseline{tests: make(map[string]baselineTest)}
+
+	samples := make(map[string][]Test)
+	for _, run := range runs {
+		b.Runs = append(b.Runs, run.ID)
+		for _, t := range run.Tests {
+			samples[t.Name] = append(samples[t.Name], t)
+		}
+	}
+
+	for name, tests := range samples {
+		b.tests[name] = baselineTest{
+			Test: Test{
+				Name:              name,
+				DurationMs:        median(tests, func(t Test) float64 { return t.DurationMs }),
+				LoadMs:            median(tests, func(t Test) float64 { return t.LoadMs }),
+				WidgetReadyMs:     median(tests, func(t Test) float64 { return t.WidgetReadyMs }),
+				WidgetCompletedMs: median(tests, func(t Test) float64 { return t.WidgetCompletedMs }),
+			},
+			LastStatus: tests[len(tests)-1].Status,
+		}
+	}
+	return b
+}
+
+// The median of the values that are set, zero if there are none. Timings of tests that failed or were skipped are
+// left out, they tend to be off in either direction.
+func median(tests []Test, value func(t Test) float64) float64 {
+	values := make([]float64, 0, len(tests))
+	for _, t := range tests {
+		if v := value(t); v > 0 && t.Passed() {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return 0
+	}
+
+	slices.Sort(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// When a timing counts as a regression: it must be slower by both the relative and the absolute amount, so that
+// neither noise in fast tests nor small changes in slow ones are reported.
+type Thresholds struct {
+	// e.g. 0.2 for 20% slower than the baseline.
+	Relative float64
+	MinDelta time.Duration
+}
+
+// A timing of a test that got slower.
+type Regression struct {
+	Test string
+	// e.g. "duration" or "widget ready"
+	Metric     string
+	BaselineMs float64
+	LatestMs   float64
+}
+
+// How much slower it got, e.g. 0.25 for 25%.
+func (r Regression) Relative() float64 {
+	return r.LatestMs/r.BaselineMs - 1
+}
+
+type Comparison struct {
+	Latest   Run
+	Baseline Baseline
+
+	Regressions []Regression
+	// Tests that failed in the latest run, but not in the most recent baseline run they were in.
+	NewFailures []Test
+	// Tests that failed in the baseline, but passed in the latest run.
+	Fixed []string
+	// Tests that aren't in the baseline.
+	NewTests []string
+}
+
+var metrics = []struct {
+	name  string
+	value func(t Test) float64
+}{
+	{"duration", func(t Test) float64 { return t.DurationMs }},
+	{"load", func(t Test) float64 { return t.LoadMs }},
+	{"widget ready", func(t Test) float64 { return t.WidgetReadyMs }},
+	{"widget completed", func(t Test) float64 { return t.WidgetCompletedMs }},
+}
+
+// Compares the latest run to the baseline.
+func Compare(latest Run, baseline Baseline, th Thresholds) Comparison {
+	c := Comparison{Latest: latest, Baseline: baseline}
+
+	minDeltaMs := float64(th.MinDelta) / float64(time.Millisecond)
+	for _, t := range latest.Tests {
+		b, ok := baseline.tests[t.Name]
+		if !ok {
+			c.NewTests = append(c.NewTests, t.Name)
+			continue
+		}
+
+		if t.Failed() && !failed(b.LastStatus) {
+			c.NewFailures = append(c.NewFailures, t)
+		}
+		if t.Passed() && failed(b.LastStatus) {
+			c.Fixed = append(c.Fixed, t.Name)
+		}
+		// The timings of a failed test say little about the speed of the SDK.
+		if !t.Passed() {
+			continue
+		}
+
+		for _, m := range metrics {
+			before, now := m.value(b.Test), m.value(t)
+			if before <= 0 || now <= 0 {
+				continue
+			}
+			if now-before >= minDeltaMs && now > before*(1+th.Relative) {
+				c.Regressions = append(c.Regressions, Regression{
+					Test:       t.Name,
+					Metric:     m.name,
+					BaselineMs: before,
+					LatestMs:   now,
+				})
+			}
+		}
+	}
+
+	slices.SortFunc(c.Regressions, func(a, b Regression) int {
+		if n := strings.Compare(a.Test, b.Test); n != 0 {
+			return n
+		}
+		return strings.Compare(a.Metric, b.Metric)
+	})
+	slices.SortFunc(c.NewFailures, func(a, b Test) int { return strings.Compare(a.Name, b.Name) })
+	slices.Sort(c.Fixed)
+	slices.Sort(c.NewTests)
+	return c
+}
+
+// Whether the latest run got worse than the baseline.
+func (c Comparison) Regressed() bool {
+	return len(c.Regressions) > 0 || len(c.NewFailures) > 0
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package history keeps the results of autotest runs, so that `sdktest history` can spot tests that got slower or
+// started failing.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The file in `autotest.history_dir` the runs are appended to, one JSON object per line.
+const FileName = "history.jsonl"
+
+// A run of autotest.
+type Run struct {
+	// e.g. `20261016-182651`, unique enough to pick a run as the baseline.
+	ID         string    `json:"id"`
+	Started    time.Time `json:"started"`
+	DurationMs float64   `json:"durationMs"`
+	// The git commit that was tested, empty if unknown.
+	Commit  string `json:"commit,omitempty"`
+	Browser string `json:"browser"`
+	Tests   []Test `json:"tests"`
+}
+
+// The result of a test (variant) within a run. Widget timings are of the slowest widget of the test, zero if it has
+// no widget that got that far.
+type Test struct {
+	// Including the variant, e.g. `csp[compat,min]`.
+	Name string `json:"name"`
+	// "pass", "fail", "skip" or "flaky"
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+	// Loading the test page until its suite was ready to start.
+	LoadMs float64 `json:"loadMs"`
+	// From the page starting to load until the widget was ready.
+	WidgetReadyMs float64 `json:"widgetReadyMs"`
+	// From the widget starting until it completed.
+	WidgetCompletedMs float64 `json:"widgetCompletedMs"`
+}
+
+// Whether the test passed, possibly after retrying.
+func (t Test) Passed() bool {
+	return passed(t.Status)
+}
+
+func (t Test) Failed() bool {
+	return failed(t.Status)
+}
+
+func passed(status string) bool {
+	return status == "pass" || status == "flaky"
+}
+
+// Anything but passing or skipping, a test that never finished has failed too.
+func failed(status string) bool {
+	return !passed(status) && status != "skip"
+}
+
+// A run ID for a run started at the time.
+func NewRunID(started time.Time) string {
+	return started.UTC().Format("20060102-150405")
+}
+
+// The short hash of the commit checked out in the working directory, empty if it isn't a git checkout.
+func CurrentCommit() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Appends the run to the history in dir, creating it if needed.
+func Append(dir string, run Run) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Loads the runs in the history in dir, oldest first. A missing history has no runs.
+func Load(dir string) ([]Run, error) {
+	f, err := os.Open(filepath.Join(dir, FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	runs := make([]Run, 0)
+	scanner := bufio.NewScanner(f)
+	// A run with many tests makes for a long line.
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", FileName, n, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
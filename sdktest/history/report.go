@@ -0,0 +1,160 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package history
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/knadh/koanf/v2"
+)
+
+// Exit codes of `sdktest history`.
+const (
+	ExitOK = 0
+	// The latest run has regressions or new failures.
+	ExitRegressed = 1
+	// The history couldn't be loaded or doesn't have enough runs to compare.
+	ExitError = 2
+)
+
+func fatalf(format string, v ...any) {
+	log.Printf(format, v...)
+	os.Exit(ExitError)
+}
+
+// The runs to compare the latest run against: the one given by `history.baseline`, or else the `history.window` runs
+// before the latest. Only runs in the same browser as the latest are comparable.
+func selectBaseline(k *koanf.Koanf, runs []Run) []Run {
+	latest := runs[len(runs)-1]
+	if id := k.String("history.baseline"); id != "" {
+		if id == latest.ID {
+			fatalf("Baseline run %q is the latest run, pick an earlier one", id)
+		}
+		for _, run := range runs {
+			if run.ID != id {
+				continue
+			}
+			if run.Browser != latest.Browser {
+				fatalf("Baseline run %q ran in %s, but the latest run in %s", id, run.Browser, latest.Browser)
+			}
+			return []Run{run}
+		}
+		fatalf("Baseline run %q isn't in the history", id)
+	}
+
+	window := 5
+	if k.Exists("history.window") {
+		window = k.Int("history.window")
+	}
+	if window < 1 {
+		fatalf("history.window must be at least 1")
+	}
+	previous := make([]Run, 0, len(runs))
+	for _, run := range runs[:len(runs)-1] {
+		if run.Browser == latest.Browser {
+			previous = append(previous, run)
+		}
+	}
+	if len(previous) == 0 {
+		fatalf("The history has no runs in %s before the latest run to compare against", latest.Browser)
+	}
+	return previous[max(0, len(previous)-window):]
+}
+
+func thresholds(k *koanf.Koanf) Thresholds {
+	th := Thresholds{Relative: 0.2, MinDelta: 100 * time.Millisecond}
+	if k.Exists("history.threshold") {
+		th.Relative = k.Float64("history.threshold")
+	}
+	if k.Exists("history.min_delta") {
+		th.MinDelta = k.Duration("history.min_delta")
+	}
+	return th
+}
+
+// Compares the latest run in `autotest.history_dir` against a baseline and prints the regressions, it exits with
+// ExitRegressed if there are any.
+func Start(k *koanf.Koanf) {
+	dir := k.String("autotest.history_dir")
+	if dir == "" {
+		fatalf("Set autotest.history_dir (or --history-dir) to the folder the history of autotest runs is kept in")
+	}
+
+	runs, err := Load(dir)
+	if err != nil {
+		fatalf("Failed to load the history: %v", err)
+	}
+	if len(runs) < 2 {
+		fatalf("The history in %s has %d runs, at least two are needed to compare", dir, len(runs))
+	}
+
+	latest := runs[len(runs)-1]
+	c := Compare(latest, NewBaseline(selectBaseline(k, runs)), thresholds(k))
+	c.Print(color.Output)
+
+	if c.Regressed() {
+		os.Exit(ExitRegressed)
+	}
+	os.Exit(ExitOK)
+}
+
+func describeRun(run Run) string {
+	desc := fmt.Sprintf("%s (%s", run.ID, run.Started.Local().Format(time.DateTime))
+	if run.Commit != "" {
+		desc += ", " + run.Commit
+	}
+	return desc + ")"
+}
+
+func formatMs(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Millisecond).String()
+}
+
+// Prints the comparison as tables of regressions and new failures.
+func (c Comparison) Print(out io.Writer) {
+	fmt.Fprintf(out, "%s %s\n", color.HiBlackString("latest:  "), describeRun(c.Latest))
+	baseline := strings.Join(c.Baseline.Runs, ", ")
+	if len(c.Baseline.Runs) > 1 {
+		baseline = fmt.Sprintf("median of %d runs (%s)", len(c.Baseline.Runs), baseline)
+	}
+	fmt.Fprintf(out, "%s %s\n", color.HiBlackString("baseline:"), baseline)
+
+	if len(c.NewFailures) > 0 {
+		fmt.Fprintf(out, "\n%s\n", color.RedString("New failures:"))
+		for _, t := range c.NewFailures {
+			fmt.Fprintf(out, "  %s %s\n", t.Name, color.HiBlackString(fmt.Sprintf("(%s)", t.Status)))
+		}
+	}
+
+	if len(c.Regressions) > 0 {
+		fmt.Fprintf(out, "\n%s\n", color.YellowString("Slower than the baseline:"))
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "  TEST\tMETRIC\tBASELINE\tLATEST\tCHANGE\n")
+		for _, r := range c.Regressions {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t+%.0f%%\n", r.Test, r.Metric, formatMs(r.BaselineMs), formatMs(r.LatestMs), r.Relative()*100)
+		}
+		tw.Flush()
+	}
+
+	if len(c.Fixed) > 0 {
+		fmt.Fprintf(out, "\n%s %s\n", color.GreenString("Fixed:"), strings.Join(c.Fixed, ", "))
+	}
+	if len(c.NewTests) > 0 {
+		fmt.Fprintf(out, "\n%s %s\n", color.HiBlackString("New tests:"), strings.Join(c.NewTests, ", "))
+	}
+
+	if c.Regressed() {
+		fmt.Fprintf(out, "\n%s\n", color.RedString(fmt.Sprintf("%d regressions and %d new failures", len(c.Regressions), len(c.NewFailures))))
+	} else {
+		fmt.Fprintf(out, "\n%s\n", color.CyanString("No regressions"))
+	}
+}
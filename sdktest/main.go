@@ -7,10 +7,13 @@ package main
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/fatih/color"
 	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/autotest"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/bundle"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/history"
 	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/server"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/file"
@@ -19,11 +22,43 @@ import (
 
 var CLI struct {
 	Autotest struct {
-		Serve bool `help:"Serve the test pages so you can open them in a browser."`
+		Tests              []string `arg:"" optional:"" name:"test" help:"Names of the tests to run, defaults to all tests."`
+		Run                string   `placeholder:"REGEX" help:"Only run tests with a name matching this regular expression."`
+		Skip               string   `placeholder:"REGEX" help:"Skip tests with a name matching this regular expression."`
+		Subtest            string   `placeholder:"REGEX" help:"Only run the sdktest.test(...) cases with a name matching this JavaScript regular expression, it is applied in the test page."`
+		Tags               []string `placeholder:"TAG,..." help:"Only run tests that have any of these tags in their config.yaml meta."`
+		ExcludeTags        []string `placeholder:"TAG,..." help:"Skip tests that have any of these tags in their config.yaml meta."`
+		Matrix             []string `placeholder:"VARIANT,..." help:"Run every test once per SDK bundle variant: plain, compat, min or compat+min (overrides autotest.matrix)."`
+		Profiles           []string `placeholder:"PROFILE,..." help:"Run every test once per emulation profile defined under profiles (overrides autotest.profiles)."`
+		Browser            string   `enum:",chromium,firefox" default:"" help:"Browser to run the tests in: chromium or firefox (overrides autotest.browser)."`
+		RemoteDebuggingURL []string `name:"remote-debugging-url" placeholder:"URL,..." help:"Connect to these running browsers instead of launching one (overrides autotest.remote_debugging_url)."`
+		Instances          int      `help:"Number of isolated browser instances to spread the tests over (overrides autotest.instances)."`
+		Retries            *int     `help:"Re-run failing tests up to this many times, tests that pass then are reported as flaky (overrides autotest.retries)."`
+		Serve              bool     `help:"Serve the test pages so you can open them in a browser."`
+		ReportJUnit        string   `name:"report-junit" placeholder:"PATH" help:"Write a JUnit XML report to this path (overrides autotest.reports.junit)."`
+		ArtifactsDir       string   `placeholder:"DIR" help:"Write HAR files and the screenshots, console logs and DOM snapshots of failed tests to this folder (overrides autotest.artifacts_dir)."`
+		HistoryDir         string   `placeholder:"DIR" help:"Append the results of the run to the history in this folder (overrides autotest.history_dir)."`
+		CoverageDir        string   `placeholder:"DIR" help:"Collect the JS coverage of the SDK and write lcov and HTML reports of it to this folder, chromium only (overrides autotest.coverage_dir)."`
+		Format             string   `enum:"text,json" default:"text" help:"Output format, json emits newline-delimited JSON events on stdout (${enum})."`
 	} `cmd:"" help:"Run the tests with an instrumented (headless) browser."`
 
 	Server struct {
 	} `cmd:"" help:"Serve tests in a webserver."`
+
+	History struct {
+		HistoryDir string        `placeholder:"DIR" help:"Folder the history of autotest runs is kept in (overrides autotest.history_dir)."`
+		Baseline   string        `placeholder:"RUN" help:"ID of the run to compare against, defaults to the median of the runs before the latest (overrides history.baseline)."`
+		Window     int           `help:"Number of runs before the latest the baseline is the median of (overrides history.window)."`
+		Threshold  float64       `help:"How much slower a test must be to count as a regression, e.g. 0.2 for 20% (overrides history.threshold)."`
+		MinDelta   time.Duration `placeholder:"DURATION" help:"How much slower a test must be at least, e.g. 100ms (overrides history.min_delta)."`
+	} `cmd:"" help:"Compare the latest autotest run in the history against a baseline."`
+
+	BundleReport struct {
+		Dist   string `placeholder:"DIR" help:"The dist folder to report on, defaults to ../dist (overrides bundle_report.dist)."`
+		Timing bool   `help:"Also measure the parse and execute time of the scripts in headless chromium (overrides bundle_report.timing)."`
+		Runs   int    `help:"Number of runs the load cost is the median of (overrides bundle_report.runs)."`
+		Format string `enum:"text,json" default:"text" help:"Output format (${enum})."`
+	} `cmd:"" name:"bundle-report" help:"Report the raw and compressed sizes of the dist bundles and check them against budgets."`
 }
 
 func main() {
@@ -37,14 +72,68 @@ func main() {
 
 	ctx := kong.Parse(&CLI)
 	switch ctx.Command() {
-	case "autotest":
+	case "autotest", "autotest <test>":
 		go s.Start(port)
-		fmt.Fprintf(color.Output, "%s", color.HiBlueString("Running autotest"))
+		// Keep stdout clean for the JSON event stream.
+		out := color.Output
+		if CLI.Autotest.Format == "json" {
+			out = color.Error
+		}
+		fmt.Fprintf(out, "%s", color.HiBlueString("Running autotest"))
 		if CLI.Autotest.Serve || k.Bool("autotest.serve") {
-			fmt.Fprintf(color.Output, "%s", color.BlackString(fmt.Sprintf(" (serving on http://localhost:%d)", port)))
+			fmt.Fprintf(out, "%s", color.BlackString(fmt.Sprintf(" (serving on http://localhost:%d)", port)))
+		}
+		fmt.Fprint(out, "\n\n")
+		if CLI.Autotest.ReportJUnit != "" {
+			k.Set("autotest.reports.junit", CLI.Autotest.ReportJUnit)
+		}
+		if CLI.Autotest.ArtifactsDir != "" {
+			k.Set("autotest.artifacts_dir", CLI.Autotest.ArtifactsDir)
+		}
+		if CLI.Autotest.HistoryDir != "" {
+			k.Set("autotest.history_dir", CLI.Autotest.HistoryDir)
+		}
+		if CLI.Autotest.CoverageDir != "" {
+			k.Set("autotest.coverage_dir", CLI.Autotest.CoverageDir)
+		}
+		k.Set("autotest.format", CLI.Autotest.Format)
+		if len(CLI.Autotest.Tests) > 0 {
+			k.Set("autotest.tests", CLI.Autotest.Tests)
+		}
+		if CLI.Autotest.Run != "" {
+			k.Set("autotest.run", CLI.Autotest.Run)
+		}
+		if CLI.Autotest.Skip != "" {
+			k.Set("autotest.skip", CLI.Autotest.Skip)
+		}
+		if CLI.Autotest.Subtest != "" {
+			k.Set("autotest.subtest", CLI.Autotest.Subtest)
+		}
+		if len(CLI.Autotest.Tags) > 0 {
+			k.Set("autotest.tags", CLI.Autotest.Tags)
+		}
+		if len(CLI.Autotest.ExcludeTags) > 0 {
+			k.Set("autotest.exclude_tags", CLI.Autotest.ExcludeTags)
+		}
+		if len(CLI.Autotest.Matrix) > 0 {
+			k.Set("autotest.matrix", CLI.Autotest.Matrix)
 		}
-		fmt.Print("\n\n")
-		autotest.Start(k)
+		if len(CLI.Autotest.RemoteDebuggingURL) > 0 {
+			k.Set("autotest.remote_debugging_url", CLI.Autotest.RemoteDebuggingURL)
+		}
+		if CLI.Autotest.Instances > 0 {
+			k.Set("autotest.instances", CLI.Autotest.Instances)
+		}
+		if CLI.Autotest.Browser != "" {
+			k.Set("autotest.browser", CLI.Autotest.Browser)
+		}
+		if CLI.Autotest.Retries != nil {
+			k.Set("autotest.retries", *CLI.Autotest.Retries)
+		}
+		if len(CLI.Autotest.Profiles) > 0 {
+			k.Set("autotest.profiles", CLI.Autotest.Profiles)
+		}
+		autotest.Start(k, s.RequestLog, s.MockAPI)
 	case "server":
 		log.Printf("Starting sdktest server: http://localhost:%d\n", port)
 		err := s.Start(port)
@@ -53,6 +142,35 @@ func main() {
 			fmt.Fprintf(color.Output, "%s", color.RedString(fmt.Sprintf("Failed to start server: %v\n", err)))
 
 		}
+	case "history":
+		if CLI.History.HistoryDir != "" {
+			k.Set("autotest.history_dir", CLI.History.HistoryDir)
+		}
+		if CLI.History.Baseline != "" {
+			k.Set("history.baseline", CLI.History.Baseline)
+		}
+		if CLI.History.Window > 0 {
+			k.Set("history.window", CLI.History.Window)
+		}
+		if CLI.History.Threshold > 0 {
+			k.Set("history.threshold", CLI.History.Threshold)
+		}
+		if CLI.History.MinDelta > 0 {
+			k.Set("history.min_delta", CLI.History.MinDelta)
+		}
+		history.Start(k)
+	case "bundle-report":
+		if CLI.BundleReport.Dist != "" {
+			k.Set("bundle_report.dist", CLI.BundleReport.Dist)
+		}
+		if CLI.BundleReport.Timing {
+			k.Set("bundle_report.timing", true)
+		}
+		if CLI.BundleReport.Runs > 0 {
+			k.Set("bundle_report.runs", CLI.BundleReport.Runs)
+		}
+		k.Set("bundle_report.format", CLI.BundleReport.Format)
+		bundle.Start(k)
 	default:
 		panic(ctx.Command())
 	}
@@ -0,0 +1,161 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package mockapi
+
+import (
+	"embed"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+)
+
+// Endpoint is the special `api_endpoint` value that points the tests at the mock API.
+const Endpoint = "mock"
+
+const (
+	AgentPath  = "/api/v2/captcha/agent"
+	WidgetPath = "/api/v2/captcha/widget"
+)
+
+//go:embed *.tmpl.html
+var embedFS embed.FS
+
+var templates *template.Template = template.Must(template.New("").ParseFS(embedFS, "*.tmpl.*"))
+
+// Options configure the behavior of the mock API, they are read from `mock_api` in the sdktest config.
+type Options struct {
+	// "noninteractive" (default) completes widgets without any clicks, "interactive" waits for the checkbox to be clicked.
+	Mode string `koanf:"mode"`
+	// Delay between the state transitions of a widget, defaults to 50ms.
+	StepDelay time.Duration `koanf:"step_delay"`
+	// Time after completion until the widget expires, zero means it never expires.
+	ExpireAfter time.Duration `koanf:"expire_after"`
+}
+
+// The options as they are passed to the mock agent and widget pages.
+type pageOptions struct {
+	Mode          string `json:"mode"`
+	StepDelayMs   int64  `json:"stepDelayMs"`
+	ExpireAfterMs int64  `json:"expireAfterMs"`
+	WidgetError   string `json:"widgetError"`
+}
+
+type pageTemplateData struct {
+	Options []byte
+}
+
+// Serves the agent and widget iframe pages, which speak the same postMessage protocol as the real API.
+type Server struct {
+	defaults Scenario
+
+	mu sync.Mutex
+	// Scenario key (see ScenarioKey) to the scenario that is currently running for it.
+	runs map[string]*scenarioRun
+}
+
+func NewServer(k *koanf.Koanf) *Server {
+	var defaults Scenario
+	k.Unmarshal("mock_api", &defaults)
+
+	return &Server{
+		defaults: defaults,
+		runs:     make(map[string]*scenarioRun),
+	}
+}
+
+// StartScenario (re)starts the scenario for given key, requests from the matching page are answered accordingly. The
+// runID is that of the autotest run of the page, if any, see EndRun.
+func (s *Server) StartScenario(key string, runID string, scenario Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs[key] = &scenarioRun{
+		scenario: scenario,
+		runID:    runID,
+	}
+}
+
+// EndRun forgets the scenarios started by the pages of an autotest run once it is done. The keys of these scenarios
+// contain the unique run ID, so they would otherwise pile up.
+func (s *Server) EndRun(runID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, run := range s.runs {
+		if run.runID == runID {
+			delete(s.runs, key)
+		}
+	}
+}
+
+func (s *Server) HandleAgent(res http.ResponseWriter, req *http.Request) {
+	s.handleFrame(res, req, "agent")
+}
+
+func (s *Server) HandleWidget(res http.ResponseWriter, req *http.Request) {
+	s.handleFrame(res, req, "widget")
+}
+
+func (s *Server) handleFrame(res http.ResponseWriter, req *http.Request, frame string) {
+	s.mu.Lock()
+	run, ok := s.runs[scenarioKeyFromReferer(req)]
+	s.mu.Unlock()
+	if !ok {
+		run = &scenarioRun{scenario: s.defaults}
+	}
+
+	fs := run.scenario.Agent
+	if frame == "widget" {
+		fs = run.scenario.Widget
+	}
+
+	if fs.Delay > 0 {
+		select {
+		case <-time.After(fs.Delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if status := run.countLoad(frame); status != 0 {
+		http.Error(res, "mock_api scenario failure", status)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := renderPage(res, frame+".tmpl.html", run.scenario)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func renderPage(w io.Writer, name string, scenario Scenario) error {
+	opts := pageOptions{
+		Mode:          scenario.Mode,
+		StepDelayMs:   scenario.StepDelay.Milliseconds(),
+		ExpireAfterMs: scenario.ExpireAfter.Milliseconds(),
+		WidgetError:   scenario.Widget.Error,
+	}
+	if opts.Mode == "" {
+		opts.Mode = "noninteractive"
+	}
+	if opts.StepDelayMs == 0 {
+		opts.StepDelayMs = 50
+	}
+
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	return templates.ExecuteTemplate(w, name, pageTemplateData{
+		Options: optsJSON,
+	})
+}
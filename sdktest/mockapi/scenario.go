@@ -0,0 +1,98 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package mockapi
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scenario scripts the behavior of the mock API for a test case, it is set under `mock_api` in the test's config.yaml.
+//
+// Example, the agent fails to load twice and widgets error with an invalid sitekey:
+//
+//	mock_api:
+//	  agent:
+//	    failures: 2
+//	  widget:
+//	    error: sitekey_invalid
+type Scenario struct {
+	Options `koanf:",squash"`
+
+	Agent  FrameScenario `koanf:"agent"`
+	Widget FrameScenario `koanf:"widget"`
+}
+
+// FrameScenario scripts how the requests for the agent or widget iframe are answered.
+type FrameScenario struct {
+	// Number of requests that fail before the iframe loads, -1 makes every request fail.
+	Failures int `koanf:"failures"`
+	// HTTP status code of the failed requests, defaults to 503.
+	Status int `koanf:"status"`
+	// Delay before responding to a request, use a long delay to simulate a hanging server.
+	Delay time.Duration `koanf:"delay"`
+	// Error code the widget ends up in instead of becoming ready, such as `sitekey_invalid`. Only used for widgets.
+	Error string `koanf:"error"`
+}
+
+// Keeps track of the requests made within a scenario.
+type scenarioRun struct {
+	scenario Scenario
+	// The autotest run of the page that started the scenario (see requestlog.RunParam), empty for pages opened by hand.
+	runID string
+
+	mu          sync.Mutex
+	agentLoads  int
+	widgetLoads int
+}
+
+// Counts the request and returns the status code to fail it with, or zero if it should succeed.
+func (r *scenarioRun) countLoad(frame string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	fs := r.scenario.Agent
+	if frame == "widget" {
+		r.widgetLoads++
+		n = r.widgetLoads
+		fs = r.scenario.Widget
+	} else {
+		r.agentLoads++
+		n = r.agentLoads
+	}
+
+	if fs.Failures == -1 || n <= fs.Failures {
+		if fs.Status == 0 {
+			return http.StatusServiceUnavailable
+		}
+		return fs.Status
+	}
+	return 0
+}
+
+// ScenarioKey identifies a scenario run by the test case name and the query of its page, so the variants of a test
+// (e.g. `?compat` and `?min`) that run at the same time don't restart each other's scenario.
+func ScenarioKey(testCaseName string, pageURL *url.URL) string {
+	return testCaseName + "?" + pageURL.RawQuery
+}
+
+// Returns the scenario key of the test page the iframe was requested from, based on the Referer.
+func scenarioKeyFromReferer(req *http.Request) string {
+	u, err := url.Parse(req.Referer())
+	if err != nil {
+		return ""
+	}
+
+	path, ok := strings.CutPrefix(u.Path, "/test/")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(path, "/")
+	return ScenarioKey(name, u)
+}
@@ -5,14 +5,17 @@
 package render
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 
 	gotexttemplate "text/template"
 
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/mockapi"
 	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/template"
 	"github.com/knadh/koanf/v2"
 )
@@ -22,13 +25,15 @@ type TestCaseHandler struct {
 	testFolder string
 	fs         fs.FS
 	k          *koanf.Koanf
+	mockAPI    *mockapi.Server
 }
 
-func NewRenderHandler(k *koanf.Koanf) *TestCaseHandler {
+func NewRenderHandler(k *koanf.Koanf, mockAPI *mockapi.Server) *TestCaseHandler {
 	return &TestCaseHandler{
 		testFolder: k.MustString("test_folder"),
 		fs:         os.DirFS(k.MustString("test_folder")),
 		k:          k,
+		mockAPI:    mockAPI,
 	}
 }
 
@@ -48,8 +53,32 @@ func (r *TestCaseHandler) HandleTestCaseListing(res http.ResponseWriter, req *ht
 		panic(err)
 	}
 
+	// Optionally filter by tag, e.g. `/test/?tag=network`.
+	tag := req.URL.Query().Get("tag")
+	testCases := make([]template.TestCaseListingEntry, 0, len(names))
+	allTags := make([]string, 0)
+	for _, name := range names {
+		conf, _ := LoadTestCaseConfig(r.k, r.testFolder, name)
+		for _, t := range conf.Meta.Tags {
+			if !slices.Contains(allTags, t) {
+				allTags = append(allTags, t)
+			}
+		}
+
+		if tag != "" && !slices.Contains(conf.Meta.Tags, tag) {
+			continue
+		}
+		testCases = append(testCases, template.TestCaseListingEntry{
+			Name: name,
+			Meta: conf.Meta,
+		})
+	}
+	slices.Sort(allTags)
+
 	err = template.RenderTestListing(res, template.TestCaseListingTemplateData{
-		TestCases: names,
+		TestCases: testCases,
+		Tags:      allTags,
+		Tag:       tag,
 	})
 	if err != nil {
 		panic(err)
@@ -60,6 +89,10 @@ func (r *TestCaseHandler) HandleTestCasePage(res http.ResponseWriter, req *http.
 	params := r.getTestCaseParams(res, req)
 
 	rd, err := r.renderTestCase(params)
+	if errors.Is(err, ErrTemplateNotFound) && params.Page != "" {
+		http.NotFound(res, req)
+		return
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -68,11 +101,19 @@ func (r *TestCaseHandler) HandleTestCasePage(res http.ResponseWriter, req *http.
 		res.Header().Set(k, v)
 	}
 
+	// Widgets that don't configure an endpoint themselves should use the mock API too.
+	sdkAPIEndpoint := ""
+	if params.MockAPI {
+		sdkAPIEndpoint = params.Config.APIEndpoint
+	}
+
 	err = template.RenderTestCasePage(res, template.TestCaseTemplateData{
 		Name:  params.Name,
 		Title: fmt.Sprintf("%s | sdktest", params.Name),
+		Page:  rd.Page,
 
-		HTMLLang: params.Config.Language,
+		HTMLLang:       params.Config.Language,
+		SDKAPIEndpoint: sdkAPIEndpoint,
 
 		Head: rd.Head,
 		Body: rd.Body,
@@ -95,6 +136,8 @@ func (r *TestCaseHandler) HandleTestAsset(res http.ResponseWriter, req *http.Req
 		Name:                      params.Name,
 		Config:                    params.Config,
 		SiteJSPath:                getSiteJSPath("site", params.Compat, params.Min),
+		MockAPI:                   params.MockAPI,
+		Profile:                   params.Profile,
 		ReCAPTCHACompatSiteJSPath: getSiteJSPath("recaptcha-site", params.Compat, params.Min),
 		HCaptchaCompatSiteJSPath:  getSiteJSPath("hcaptcha-site", params.Compat, params.Min),
 		TestCaseDirFilepath:       filepath.Join(r.testFolder, params.Name),
@@ -6,31 +6,61 @@ package render
 
 import (
 	"bytes"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	gotexttemplate "text/template"
 
 	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/mockapi"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/requestlog"
 	"github.com/gorilla/mux"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/providers/rawbytes"
+	"github.com/knadh/koanf/v2"
 )
 
 func (r *TestCaseHandler) getTestCaseParams(res http.ResponseWriter, req *http.Request) TestCaseParameters {
 	v := mux.Vars(req)
 	testCaseName := v["name"]
+	conf, mock := LoadTestCaseConfig(r.k, r.testFolder, testCaseName)
+
+	params := TestCaseParameters{
+		Name:      testCaseName,
+		Config:    conf,
+		MockAPI:   mock,
+		Compat:    req.URL.Query().Has("compat"),
+		Min:       req.URL.Query().Has("min"),
+		Profile:   req.URL.Query().Get("profile"),
+		AssetPath: v["asset_path"],
+		Page:      v["page"],
+	}
+
+	// Loading the (entry) page itself, not one of its assets or further pages, starts the test's mock API scenario from
+	// scratch. The pages of a multi-page test share the scenario.
+	if mock && params.AssetPath == "" && params.Page == "" {
+		r.mockAPI.StartScenario(mockapi.ScenarioKey(testCaseName, req.URL), req.URL.Query().Get(requestlog.RunParam), conf.MockAPI)
+	}
+
+	return params
+}
+
+// LoadTestCaseConfig loads the global sdktest config with the config.yaml (or rendered config.tmpl.yaml) of the test
+// case on top. The returned bool is true if the test case runs against the mock API.
+func LoadTestCaseConfig(gk *koanf.Koanf, testFolder string, testCaseName string) (config.Config, bool) {
 	// Clone the global sdktest config
-	k := r.k.Copy()
+	k := gk.Copy()
 
 	// Load the additional config.yaml from the testcase folder into it (to allow overwriting)
 
-	filepathTemplateYaml := filepath.Join(r.testFolder, testCaseName, "config.tmpl.yaml")
+	filepathTemplateYaml := filepath.Join(testFolder, testCaseName, "config.tmpl.yaml")
 	if _, err := os.Stat(filepathTemplateYaml); err == nil || os.IsExist(err) { // Render the yaml template
 
 		var globalConf config.Config
 		k.Unmarshal("", &globalConf)
+		useMockAPI(&globalConf)
 
 		tpl, err := gotexttemplate.ParseFiles(filepathTemplateYaml)
 		if err != nil {
@@ -49,19 +79,21 @@ func (r *TestCaseHandler) getTestCaseParams(res http.ResponseWriter, req *http.R
 
 		k.Load(rawbytes.Provider(buf.Bytes()), yaml.Parser())
 	} else { // Load the yaml file as is
-		k.Load(file.Provider(filepath.Join(r.testFolder, testCaseName, "config.yaml")), yaml.Parser())
+		k.Load(file.Provider(filepath.Join(testFolder, testCaseName, "config.yaml")), yaml.Parser())
 	}
 
 	var conf config.Config
 	k.Unmarshal("", &conf)
+	mock := useMockAPI(&conf)
 
-	params := TestCaseParameters{
-		Name:      testCaseName,
-		Config:    conf,
-		Compat:    req.URL.Query().Has("compat"),
-		Min:       req.URL.Query().Has("min"),
-		AssetPath: v["asset_path"],
-	}
+	return conf, mock
+}
 
-	return params
+// Points the config at the mock API served by sdktest itself if `api_endpoint: mock` is configured.
+func useMockAPI(conf *config.Config) bool {
+	if conf.APIEndpoint != mockapi.Endpoint {
+		return false
+	}
+	conf.APIEndpoint = fmt.Sprintf("http://localhost:%s", conf.Port)
+	return true
 }
@@ -22,11 +22,19 @@ type TestCaseParameters struct {
 	Name      string
 	Config    config.Config
 	AssetPath string
+	// Name of the page of a multi-page test, e.g. `page2` for `/test/<name>/page2.html` (rendered from
+	// page2.tmpl.html). Empty for the entry page.
+	Page string
+
+	// The API endpoint was set to `mock`, Config.APIEndpoint now points at the mock API.
+	MockAPI bool
 
 	// Use compatiblity / polyfill scripts
 	Compat bool
 	// Use minified distribution
 	Min bool
+	// Name of the emulation profile autotest runs the page with, empty if none (or opened by hand).
+	Profile string
 }
 
 // Data that is available in the testcase's templates
@@ -38,11 +46,42 @@ type TestCaseRenderData struct {
 	HCaptchaCompatSiteJSPath  string
 	Config                    config.Config
 	TestCaseDirFilepath       string
+	// The test runs against the mock API, so its `mock_api` scenario is in effect.
+	MockAPI bool
+	// Name of the emulation profile autotest runs the page with, its settings are in `.Config.Profiles`.
+	Profile string
+	// Name of the page being rendered, e.g. `page2` for page2.tmpl.html or `index` for body.tmpl.html. Empty for
+	// assets, which are shared by the pages.
+	Page string
 }
 
 type TestCaseRenderResult struct {
 	Body []byte
 	Head []byte
+	// Name of the page that was rendered, see TestCaseRenderData.Page.
+	Page string
+}
+
+// The name of the page rendered from body.tmpl.html.
+const IndexPage = "index"
+
+// The name of the page to render for the requested one. The entry page of a test (at `/test/<name>/`) is
+// body.tmpl.html, or page1.tmpl.html for multi-page tests without one.
+func resolvePage(templates *template.Template, page string) string {
+	if page != "" {
+		return page
+	}
+	if templates.Lookup("body.tmpl.html") == nil && templates.Lookup("page1.tmpl.html") != nil {
+		return "page1"
+	}
+	return IndexPage
+}
+
+func pageTemplate(page string) string {
+	if page == IndexPage {
+		return "body.tmpl.html"
+	}
+	return page + ".tmpl.html"
 }
 
 // Basename is `site`, or `recaptcha-site`, or `hcaptcha-site`
@@ -76,6 +115,8 @@ func (r *TestCaseHandler) renderTestCase(params TestCaseParameters) (TestCaseRen
 		Name:                      params.Name,
 		Config:                    params.Config,
 		SiteJSPath:                getSiteJSPath("site", params.Compat, params.Min),
+		MockAPI:                   params.MockAPI,
+		Profile:                   params.Profile,
 		ReCAPTCHACompatSiteJSPath: getSiteJSPath("contrib/recaptcha-site", params.Compat, params.Min),
 		HCaptchaCompatSiteJSPath:  getSiteJSPath("contrib/hcaptcha-site", params.Compat, params.Min),
 		TestCaseDirFilepath:       filepath.Join(r.testFolder, params.Name),
@@ -86,12 +127,15 @@ func (r *TestCaseHandler) renderTestCase(params TestCaseParameters) (TestCaseRen
 		return TestCaseRenderResult{}, fmt.Errorf("failed to parse templates in %s: %v", params.Name, err)
 	}
 
-	body, err := executeTemplateIfExists(templates, "body.tmpl.html", renderData)
+	renderData.Page = resolvePage(templates, params.Page)
+
+	body, err := executeTemplateIfExists(templates, pageTemplate(renderData.Page), renderData)
 	if err != nil {
 		return TestCaseRenderResult{}, err
 	}
 
 	return TestCaseRenderResult{
 		Body: body,
+		Page: renderData.Page,
 	}, nil
 }
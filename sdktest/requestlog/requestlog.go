@@ -0,0 +1,98 @@
+// Copyright (c) Friendly Captcha GmbH 2023.
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+package requestlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RequestsPath serves the requests of a run as JSON: `/sdktest/api/requests?run=<id>`.
+const RequestsPath = "/sdktest/api/requests"
+
+// RunParam is the query parameter of the test page URL that holds the run ID.
+const RunParam = "run"
+
+// A request made by a test page or one of its iframes, as seen by the browser.
+type Request struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	// e.g. `https://global.frcapi.com`
+	Origin string `json:"origin"`
+	// e.g. "Document" for page and iframe navigations, "Script" or "Fetch".
+	ResourceType string `json:"resourceType"`
+	// "page" if it was made by the test page (or a same-origin iframe), otherwise the URL of the iframe that made it.
+	Target string `json:"target"`
+	// HTTP status code, zero if there was no response (yet).
+	Status int64 `json:"status"`
+	// e.g. `net::ERR_CONNECTION_REFUSED`, empty unless the request failed to load.
+	Error string `json:"error,omitempty"`
+	// Set when the request was redirected.
+	RedirectURL string `json:"redirectURL,omitempty"`
+	// True while the request is still in flight.
+	Pending bool `json:"pending"`
+
+	Started    time.Time `json:"started"`
+	DurationMs float64   `json:"duration"`
+}
+
+// A Source provides the requests of a run, for example the network recorder of the autotest runner.
+type Source interface {
+	Requests() []Request
+}
+
+// Store holds the request sources of all runs, so test pages can assert on the network traffic they caused.
+type Store struct {
+	mu   sync.Mutex
+	runs map[string]Source
+}
+
+func NewStore() *Store {
+	return &Store{
+		runs: make(map[string]Source),
+	}
+}
+
+// Register makes the requests of a run available to its test page.
+func (s *Store) Register(run string, src Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs[run] = src
+}
+
+// Unregister forgets a run once it is done, so that its requests don't stay in memory.
+func (s *Store) Unregister(run string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.runs, run)
+}
+
+func (s *Store) HandleRequests(res http.ResponseWriter, req *http.Request) {
+	run := req.URL.Query().Get(RunParam)
+
+	s.mu.Lock()
+	src, ok := s.runs[run]
+	s.mu.Unlock()
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	if !ok {
+		// Only runs of the autotest runner are recorded, not pages opened by hand.
+		res.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(res).Encode(map[string]string{"error": "unknown run"})
+		return
+	}
+
+	requests := src.Requests()
+	if requests == nil {
+		requests = []Request{}
+	}
+	err := json.NewEncoder(res).Encode(requests)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,101 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import type { ClickOpts, NetworkConditions } from "./types";
+
+declare global {
+  interface Window {
+    /**
+     * Exposed by the autotest runner, see `autotest/bridge.go`.
+     */
+    __sdktestBrowser?: (payload: string) => void;
+    __sdktestBrowserResolve?: (id: number, error: string | null) => void;
+  }
+}
+
+let nextId = 0;
+const pending: { [id: number]: { resolve: () => void; reject: (e: Error) => void } } = {};
+
+window.__sdktestBrowserResolve = (id, error) => {
+  const p = pending[id];
+  if (!p) {
+    return;
+  }
+  delete pending[id];
+  if (error) {
+    p.reject(new Error(`[sdktest] browser request failed: ${error}`));
+  } else {
+    p.resolve();
+  }
+};
+
+/**
+ * Trusted input (clicks and keystrokes) dispatched by the autotest runner through the browser itself. Unlike events
+ * created with `dispatchEvent` these have `isTrusted` set, and they reach into cross-origin iframes such as the widget.
+ * The runner can also emulate network conditions.
+ */
+export class BrowserLib {
+  /**
+   * Whether the browser can be controlled, which is only the case when running in autotest in Chromium.
+   * Tests that need it should skip if not.
+   */
+  get available() {
+    return typeof window.__sdktestBrowser === "function";
+  }
+
+  private request(
+    action: string,
+    params: { selector?: string; frame?: string; text?: string; key?: string; network?: NetworkConditions },
+  ) {
+    if (!this.available) {
+      // Autotest passes a `?run=<id>` to the page, but only bridges `t.browser` in Chromium.
+      if (new URLSearchParams(window.location.search).has("run")) {
+        return Promise.reject(new Error("Controlling the browser is only supported in Chromium in autotest."));
+      }
+      return Promise.reject(new Error("Controlling the browser is only available when running in autotest."));
+    }
+
+    const id = nextId++;
+    return new Promise<void>((resolve, reject) => {
+      pending[id] = { resolve, reject };
+      window.__sdktestBrowser!(JSON.stringify({ id, action, ...params }));
+    });
+  }
+
+  /**
+   * Clicks the center of the element matching the selector, waiting for it to exist.
+   * Pass the selector of an iframe as `frame` to click an element within it, e.g.
+   * `t.browser.click(".frc-checkbox", { frame: ".frc-i-widget" })`.
+   */
+  click(selector: string, opts: ClickOpts = {}) {
+    return this.request("click", { selector, frame: opts.frame });
+  }
+
+  /**
+   * Types the text into the focused element.
+   */
+  type(text: string) {
+    return this.request("type", { text });
+  }
+
+  /**
+   * Presses a key in the focused element: Enter, Tab, Escape, Backspace, Delete, Space, ArrowDown, ArrowLeft,
+   * ArrowRight, ArrowUp, Home or End.
+   */
+  press(key: string) {
+    return this.request("press", { key });
+  }
+
+  /**
+   * Emulates network conditions for the page and all of its iframes, until changed again. Pass `{}` to stop emulating.
+   * The latency is in milliseconds, the throughputs in bytes per second, e.g.
+   * `t.browser.setNetworkConditions({ latency: 400, downloadThroughput: 50_000 })` or
+   * `t.browser.setNetworkConditions({ offline: true })`.
+   */
+  setNetworkConditions(network: NetworkConditions) {
+    return this.request("network", { network });
+  }
+}
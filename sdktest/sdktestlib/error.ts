@@ -8,7 +8,7 @@
 // Note we have to patch the prototype of errors to fix `instanceof` calls, see:
 // https://github.com/Microsoft/TypeScript/wiki/Breaking-Changes#extending-built-ins-like-error-array-and-map-may-no-longer-work
 
-import { SDKTestError } from "./types";
+import { SDKTestError, SerializedError } from "./types";
 
 export class SkipError extends Error implements SDKTestError {
     __error__ = 'skip' as const;
@@ -38,4 +38,22 @@ export class TimeoutError extends Error implements SDKTestError {
         super(`Timeout after ${duration} milliseconds`);
         Object.setPrototypeOf(this, TimeoutError.prototype);
     }
-}
\ No newline at end of file
+}
+
+/**
+ * Copies the fields of an error we care about, most of them (such as `stack`) are lost when serializing an error as JSON.
+ */
+export function serializeError(e: any): SerializedError {
+  if (!(e instanceof Error)) {
+    return { message: String(e) };
+  }
+  const err = e as any;
+  return {
+    message: err.message,
+    stack: err.stack,
+    lineNumber: err.lineNumber,
+    columnNumber: err.columnNumber,
+    fileName: err.fileName,
+    __error__: err.__error__,
+  };
+}
@@ -4,22 +4,35 @@
  * License, v. 2.0. If a copy of the MPL was not distributed with this
  * file, You can obtain one at https://mozilla.org/MPL/2.0/.
  */
-import { AssertionError, TimeoutError } from "./error";
+import { AssertionError, TimeoutError, serializeError } from "./error";
 import { SkipError } from "./error";
 import { SDKTestObject } from "./test";
-import { SDKTestResult, SDKTestSuiteResult, TestFunction, TestOpts, TestStatus, TestSuiteEntry } from "./types";
+import { TimingRecorder } from "./timing";
+import {
+  NextStep,
+  SDKTestResult,
+  SDKTestSuiteResult,
+  TestFunction,
+  TestOpts,
+  TestStatus,
+  TestSuiteEntry,
+} from "./types";
 import { SDKTestWidget, TestCaseResultWidget } from "./widget";
 
 const DEFAULT_TIMEOUT = 20_000;
 
 export class SDKTestFramework {
   private widget: SDKTestWidget;
+  private timing: TimingRecorder;
   private suite: TestSuiteEntry[] = [];
   private hasStarted: boolean = false;
   private state: TestStatus = "unstarted";
+  private next?: NextStep;
 
   constructor(widget: SDKTestWidget) {
     this.widget = widget;
+    // Created before the SDK loads, so that no state change is missed.
+    this.timing = new TimingRecorder();
     this.widget.onstart = () => this.start();
   }
 
@@ -36,7 +49,12 @@ export class SDKTestFramework {
       return;
     }
     this.hasStarted = true;
-    return this.run();
+    const result = await this.run();
+    if (result.next && result.status !== "fail") {
+      // Opened by hand, the next page waits for us to continue to it.
+      this.widget.showNext(result.next);
+    }
+    return result;
   }
 
   /**
@@ -46,6 +64,23 @@ export class SDKTestFramework {
     this.widget.setDescription(description);
   }
 
+  /**
+   * Continues the test on another page once the tests of this page have run, e.g. `sdktest.navigate("page2.html")`
+   * for the page2.tmpl.html of the test. The URL is relative to the current page, and keeps its query (such as the
+   * `compat` flag) if it has none of its own. The next page runs its own tests, which are reported as part of this test.
+   */
+  public navigate(url: string) {
+    this.next = { action: "navigate", url };
+  }
+
+  /**
+   * Reloads the page once its tests have run, the tests then run again on the reloaded page.
+   * Make sure to stop reloading eventually, e.g. based on something kept in `sessionStorage`.
+   */
+  public reload() {
+    this.next = { action: "reload" };
+  }
+
   /**
    * Add a test case
    */
@@ -65,24 +100,51 @@ export class SDKTestFramework {
     this.widget.appendToSubResults(resultWidget);
   }
 
+  /**
+   * Returns the `?subtest=<regex>` filter autotest passes into the page, if any. Throws if it isn't a valid
+   * JavaScript regular expression.
+   */
+  private getSubtestFilter(): RegExp | undefined {
+    const filter = new URLSearchParams(window.location.search).get("subtest");
+    return filter ? new RegExp(filter) : undefined;
+  }
+
   private async run() {
-    const numTests = this.suite.length;
     this.setState("running");
 
     const results: SDKTestResult[] = [];
+    let filter: RegExp | undefined;
+    try {
+      filter = this.getSubtestFilter();
+    } catch (e) {
+      // The filter is passed through as is, an invalid one fails the suite rather than running or skipping everything.
+      const err = new Error(`Invalid subtest filter, it must be a JavaScript regular expression: ${e instanceof Error ? e.message : e}`);
+      console.error(`[sdktest] ${err.message}`);
+      results.push({ name: "subtest filter", errors: [err.toString()], rawErrors: [err], status: "fail", duration: 0 });
+    }
+    const numTests = results.length > 0 ? 0 : this.suite.length;
 
     for (let i = 0; i < numTests; i++) {
       const test = this.suite[i];
+      if (filter && !filter.test(test.opts.name)) {
+        // Filtered out tests are not part of the results at all.
+        test.resultWidget.setState({ name: test.opts.name, status: "skip", rawErrors: [], errors: [], duration: 0 });
+        continue;
+      }
       const testObj = new SDKTestObject(this, test.opts);
       const result: SDKTestResult = {
+        name: test.opts.name,
         errors: testObj.errors.map(s => s.toString()),
         rawErrors: testObj.errors,
         status: "running",
+        duration: 0,
       };
       results.push(result);
 
+      const start = Date.now();
       const setState = (state: TestStatus) => {
         result.status = state;
+        result.duration = Date.now() - start;
         test.resultWidget.setState(result);
       };
 
@@ -123,7 +185,10 @@ export class SDKTestFramework {
 
     const suiteResult: SDKTestSuiteResult = {
       status: "pass",
-      results: results,
+      results: results.map(r => ({ ...r, rawErrors: r.rawErrors.map(serializeError) })),
+      page: this.widget.page,
+      next: this.next,
+      timings: this.timing.timings(),
     };
 
 
@@ -0,0 +1,80 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import type { RecordedRequest, RequestFilter } from "./types";
+
+const REQUESTS_PATH = "/sdktest/api/requests";
+
+/**
+ * Access to the requests the browser made for this page and its iframes, as recorded by the autotest runner.
+ * The requests are only recorded when running in autotest, which passes a `?run=<id>` to the page.
+ */
+export class NetworkLib {
+  /**
+   * ID of the autotest run, undefined if the page was opened by hand.
+   */
+  public readonly runId?: string;
+
+  constructor() {
+    this.runId = new URLSearchParams(window.location.search).get("run") || undefined;
+  }
+
+  /**
+   * Whether requests are recorded for this page, tests that depend on them should skip if not.
+   */
+  get available() {
+    return this.runId !== undefined;
+  }
+
+  /**
+   * Returns the requests made so far, optionally only those matching the filter.
+   */
+  async requests(filter: RequestFilter = {}): Promise<RecordedRequest[]> {
+    if (!this.available) {
+      throw new Error("Requests are only recorded when running in autotest.");
+    }
+
+    const resp = await fetch(`${REQUESTS_PATH}?run=${encodeURIComponent(this.runId!)}`, { cache: "no-store" });
+    if (!resp.ok) {
+      throw new Error(`Failed to retrieve recorded requests: ${resp.status}`);
+    }
+    const requests: RecordedRequest[] = await resp.json();
+    return requests.filter((r) => matchesFilter(r, filter));
+  }
+
+  /**
+   * Polls until a request matching the filter has finished, or the timeout (in milliseconds) expires.
+   */
+  async waitForRequest(filter: RequestFilter, timeout = 5000): Promise<RecordedRequest | undefined> {
+    const deadline = Date.now() + timeout;
+    while (Date.now() < deadline) {
+      const requests = await this.requests({ ...filter, pending: false });
+      if (requests.length > 0) {
+        return requests[0];
+      }
+      await new Promise((r) => setTimeout(r, 100));
+    }
+    return undefined;
+  }
+}
+
+function matchesFilter(r: RecordedRequest, filter: RequestFilter) {
+  if (filter.url !== undefined) {
+    if (typeof filter.url === "string" ? !r.url.includes(filter.url) : !filter.url.test(r.url)) {
+      return false;
+    }
+  }
+  if (filter.origin !== undefined && r.origin !== filter.origin) {
+    return false;
+  }
+  if (filter.resourceType !== undefined && r.resourceType !== filter.resourceType) {
+    return false;
+  }
+  if (filter.pending !== undefined && r.pending !== filter.pending) {
+    return false;
+  }
+  return true;
+}
@@ -21,6 +21,8 @@ import {
 import { SDKTestFramework } from "./framework";
 import type { TestOpts } from "./types";
 import { AssertionError, SkipError } from "./error";
+import { BrowserLib } from "./browser";
+import { NetworkLib } from "./network";
 
 export class AssertLib {
   private sdk;
@@ -207,6 +209,16 @@ export class SDKTestObject {
    */
   public require: AssertLib;
 
+  /**
+   * The requests made by the page and its iframes, only available when running in autotest.
+   */
+  public network: NetworkLib;
+
+  /**
+   * Trusted clicks and keystrokes, only available when running in autotest in Chromium.
+   */
+  public browser: BrowserLib;
+
   public errors: Error[] = [];
 
   constructor(framework: SDKTestFramework, opts: TestOpts) {
@@ -225,6 +237,8 @@ export class SDKTestObject {
       }
     }
 
+    this.network = new NetworkLib();
+    this.browser = new BrowserLib();
     this.assert = new AssertLib(this.sdk, true, (err) => this.errors.push(err));
     this.require = new AssertLib(this.sdk, false, (err) => this.errors.push(err));
   }
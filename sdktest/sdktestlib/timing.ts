@@ -0,0 +1,50 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import type { PageTimings, WidgetTimings } from "./types";
+
+/**
+ * Records when the widgets of the page first enter each state of their lifecycle, so that autotest can check them
+ * against the timing budgets of the test. Widgets in a shadow root are not seen, as their events don't leave it.
+ */
+export class TimingRecorder {
+  private widgets: WidgetTimings[] = [];
+
+  constructor() {
+    document.addEventListener("frc:widget.statechange", (ev) => {
+      const detail = (ev as CustomEvent<{ id: string; state: string }>).detail;
+      if (detail) {
+        this.record(detail.id, detail.state);
+      }
+    });
+  }
+
+  private record(id: string, state: string) {
+    let w = this.widgets.filter((w) => w.id === id)[0];
+    if (!w) {
+      w = { id, states: {} };
+      this.widgets.push(w);
+    }
+    // Only the first time counts, a widget that is reset goes through its states again.
+    if (w.states[state] === undefined) {
+      w.states[state] = performance.now();
+    }
+  }
+
+  /**
+   * The timings so far, in milliseconds since the page started loading.
+   */
+  public timings(): PageTimings {
+    const nav = performance.getEntriesByType
+      ? (performance.getEntriesByType("navigation")[0] as PerformanceNavigationTiming | undefined)
+      : undefined;
+    return {
+      domContentLoaded: nav ? nav.domContentLoadedEventEnd : 0,
+      load: nav ? nav.loadEventEnd : 0,
+      widgets: this.widgets,
+    };
+  }
+}
@@ -33,12 +33,126 @@ export interface SDKTestError {
 }
 
 export type SDKTestResult = {
+  name: string;
   status: TestStatus;
   rawErrors: Error[];
-  errors: string[]
+  errors: string[];
+  /**
+   * Duration of the test in milliseconds.
+   */
+  duration: number;
+};
+
+/**
+ * An error in a form that survives being passed to the autotest runner as JSON.
+ */
+export type SerializedError = {
+  message: string;
+  stack?: string;
+  lineNumber?: number;
+  columnNumber?: number;
+  fileName?: string;
+  __error__?: SDKTestError["__error__"];
 };
 
 export type SDKTestSuiteResult = {
   status: TestStatus;
-  results: SDKTestResult[];
+  results: (Omit<SDKTestResult, "rawErrors"> & { rawErrors: SerializedError[] })[];
+  /**
+   * Name of the page the suite ran on, e.g. `page2` for page2.tmpl.html or `index` for body.tmpl.html.
+   */
+  page: string;
+  /**
+   * What to do once the suite of this page has run, see `sdktest.navigate()` and `sdktest.reload()`.
+   */
+  next?: NextStep;
+  timings: PageTimings;
+};
+
+/**
+ * When the page loaded and its widgets went through their lifecycle, in milliseconds since the page started loading.
+ * Zero for what didn't happen (yet).
+ */
+export type PageTimings = {
+  domContentLoaded: number;
+  load: number;
+  widgets: WidgetTimings[];
+};
+
+export type WidgetTimings = {
+  id: string;
+  /**
+   * When the widget first entered each state, e.g. `{ init: 210, unactivated: 480, activating: 1020, ... }`.
+   */
+  states: { [state: string]: number };
+};
+
+/**
+ * A navigation that continues the test on another (or the same) page.
+ */
+export type NextStep = { action: "navigate"; url: string } | { action: "reload" };
+
+/**
+ * A request made by the test page or one of its iframes, as recorded by the autotest runner.
+ */
+export type RecordedRequest = {
+  url: string;
+  method: string;
+  /**
+   * e.g. `https://global.frcapi.com`
+   */
+  origin: string;
+  /**
+   * e.g. "Document" for page and iframe navigations, "Script" or "Fetch".
+   */
+  resourceType: string;
+  /**
+   * "page" if it was made by the test page (or a same-origin iframe), otherwise the URL of the iframe that made it.
+   */
+  target: string;
+  /**
+   * HTTP status code, 0 if there was no response (yet).
+   */
+  status: number;
+  /**
+   * Set if the request failed to load, e.g. `net::ERR_CONNECTION_REFUSED`.
+   */
+  error?: string;
+  redirectURL?: string;
+  pending: boolean;
+  started: string;
+  /**
+   * Duration of the request in milliseconds.
+   */
+  duration: number;
+};
+
+export type RequestFilter = {
+  /**
+   * Substring of or regular expression for the URL.
+   */
+  url?: string | RegExp;
+  origin?: string;
+  resourceType?: string;
+  pending?: boolean;
+};
+
+export type ClickOpts = {
+  /**
+   * Selector of the iframe (in the test page) the element is in.
+   */
+  frame?: string;
+};
+
+export type NetworkConditions = {
+  offline?: boolean;
+  /**
+   * Minimum latency of requests in milliseconds.
+   */
+  latency?: number;
+  /**
+   * Maximum throughput in bytes per second, no throttling if omitted.
+   */
+  downloadThroughput?: number;
+  uploadThroughput?: number;
 };
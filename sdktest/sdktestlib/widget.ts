@@ -4,7 +4,7 @@
  * License, v. 2.0. If a copy of the MPL was not distributed with this
  * file, You can obtain one at https://mozilla.org/MPL/2.0/.
  */
-import { SDKTestResult } from "./types";
+import { NextStep, SDKTestResult } from "./types";
 import { TestOpts, TestStatus } from "./types";
 
 export class TestCaseResultWidget {
@@ -27,7 +27,7 @@ export class TestCaseResultWidget {
     container.appendChild(this.resultEl);
 
     this.opts = opts;
-    this.setState({ rawErrors: [], status: "unstarted", errors: [] });
+    this.setState({ name: opts.name, rawErrors: [], status: "unstarted", errors: [], duration: 0 });
   }
 
   public getElement(): HTMLElement {
@@ -60,6 +60,12 @@ export class SDKTestWidget {
   private startButtonEl = document.querySelector(".sdktest-start") as HTMLButtonElement;
   private subresultsEl = document.querySelector(".sdktest-subresults") as HTMLUListElement;
   private descriptionEl = document.querySelector(".sdktest-description") as HTMLButtonElement;
+  private nextEl = document.querySelector(".sdktest-next") as HTMLAnchorElement;
+
+  /**
+   * Name of the page of the test, e.g. `page2` for page2.tmpl.html or `index` for body.tmpl.html.
+   */
+  public readonly page = this.widgetEl.dataset.page || "index";
 
   public onstart: () => any = () => console.error("Nothing listening to start button");
 
@@ -86,4 +92,22 @@ export class SDKTestWidget {
   setDescription(description: string) {
     this.descriptionEl.textContent = description;
   }
+
+  /**
+   * Shows a link to continue the test on its next page.
+   */
+  showNext(next: NextStep) {
+    if (next.action === "navigate") {
+      const url = new URL(next.url, window.location.href);
+      if (!url.search) {
+        url.search = window.location.search;
+      }
+      this.nextEl.href = url.toString();
+      this.nextEl.textContent = "Continue to " + next.url;
+    } else {
+      this.nextEl.href = window.location.href;
+      this.nextEl.textContent = "Reload";
+    }
+    this.nextEl.hidden = false;
+  }
 }
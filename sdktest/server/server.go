@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/mockapi"
 	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/render"
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/requestlog"
 	"github.com/gorilla/mux"
 	"github.com/knadh/koanf/v2"
 )
@@ -16,11 +18,16 @@ import (
 type SDKTestServer struct {
 	router   *mux.Router
 	renderer *render.TestCaseHandler
+
+	MockAPI    *mockapi.Server
+	RequestLog *requestlog.Store
 }
 
 func NewSDKTestServer(k *koanf.Koanf) *SDKTestServer {
 	r := mux.NewRouter()
-	h := render.NewRenderHandler(k)
+	m := mockapi.NewServer(k)
+	h := render.NewRenderHandler(k, m)
+	rl := requestlog.NewStore()
 
 	distFileServer := http.FileServer(http.Dir("../dist"))
 	publicFileServer := http.FileServer(http.Dir("./public"))
@@ -30,12 +37,19 @@ func NewSDKTestServer(k *koanf.Koanf) *SDKTestServer {
 	r.HandleFunc("/scripts/sdktestlib.js", h.HandleSDKTestLibScript)
 	r.HandleFunc("/test/", h.HandleTestCaseListing)
 	r.HandleFunc("/test/{name}/", h.HandleTestCasePage)
+	r.HandleFunc("/test/{name}/{page:[A-Za-z0-9_-]+}.html", h.HandleTestCasePage)
 	r.HandleFunc("/test/{name}/{asset_path:.*}", h.HandleTestAsset)
+	r.HandleFunc(mockapi.AgentPath, m.HandleAgent)
+	r.HandleFunc(mockapi.WidgetPath, m.HandleWidget)
+	r.HandleFunc(requestlog.RequestsPath, rl.HandleRequests)
 	r.Handle("/", http.RedirectHandler("/test/", http.StatusTemporaryRedirect))
 
 	return &SDKTestServer{
 		router:   r,
 		renderer: h,
+
+		MockAPI:    m,
+		RequestLog: rl,
 	}
 }
 
@@ -8,6 +8,8 @@ import (
 	"embed"
 	"io"
 	"text/template"
+
+	"github.com/friendlycaptcha/friendly-captcha/web/captchav2/friendly-captcha-sdk/sdktest/config"
 )
 
 //go:embed *.tmpl.html
@@ -18,15 +20,28 @@ var templates *template.Template = template.Must(template.New("").ParseFS(embedF
 type TestCaseTemplateData struct {
 	Title string
 	Name  string
+	// Name of the page of the test, see render.TestCaseRenderData.Page.
+	Page string
 
 	HTMLLang string
+	// Set as the `frc-api-endpoint` meta tag if not empty.
+	SDKAPIEndpoint string
 
 	Head []byte
 	Body []byte
 }
 
+type TestCaseListingEntry struct {
+	Name string
+	Meta config.Meta
+}
+
 type TestCaseListingTemplateData struct {
-	TestCases []string
+	TestCases []TestCaseListingEntry
+	// All tags used by the test cases.
+	Tags []string
+	// The tag the listing is filtered by, empty if it isn't filtered.
+	Tag string
 }
 
 func RenderTestCasePage(w io.Writer, data TestCaseTemplateData) error {
@@ -83,3 +83,16 @@ sdktest.test({ name: "iframes exist for widgets with each configured endpoint" }
     `sdk-options-configured widget with id ${sdkConfiguredWidget.id} does not have an iframe with src of ${sdkOptionEndpoint}`,
   );
 });
+
+// The iframe `src` attributes above only tell us what the SDK intended, the recorded requests tell us what the browser
+// actually loaded.
+sdktest.test({ name: "agent iframes are requested from each configured endpoint" }, async (t) => {
+  if (!t.network.available) {
+    t.skip();
+  }
+
+  for (const endpoint of [datasetAPIEndpoint, widgetOptionEndpoint, sdkOptionEndpoint]) {
+    const request = await t.network.waitForRequest({ origin: new URL(endpoint).origin, url: "/agent" });
+    t.assert.truthy(request, `no agent request was made to ${endpoint}`);
+  }
+});
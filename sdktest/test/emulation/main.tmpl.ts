@@ -0,0 +1,38 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import { sdktest } from "../../sdktestlib/sdk.js";
+
+sdktest.description("Runs on an emulated phone, and in Tokyo with a dark color scheme.");
+
+const profile = "{{ .Profile }}";
+
+sdktest.test({ name: "one widget present" }, async (t) => {
+  t.require.numberOfWidgets(1);
+});
+
+sdktest.test({ name: "environment is emulated" }, async (t) => {
+  if (profile === "emulation_mobile") {
+    t.assert.equal(390, window.innerWidth, "viewport width");
+    t.assert.equal(3, window.devicePixelRatio, "device pixel ratio");
+    t.assert.truthy(navigator.maxTouchPoints > 0, "touch should be supported");
+    t.assert.equal("America/New_York", Intl.DateTimeFormat().resolvedOptions().timeZone, "timezone");
+  } else if (profile === "emulation_tokyo_dark") {
+    t.assert.equal("Asia/Tokyo", Intl.DateTimeFormat().resolvedOptions().timeZone, "timezone");
+    t.assert.equal("ja-JP", navigator.language, "language");
+    t.assert.truthy(window.matchMedia("(prefers-color-scheme: dark)").matches, "dark color scheme");
+  } else {
+    t.skip(); // Opened by hand.
+  }
+});
+
+sdktest.test({ name: "widget completes", timeout: 30_000 }, async (t) => {
+  const w = t.getWidget()!;
+  const completePromise = t.assert.widgetCompletes(w);
+  w.start();
+
+  await completePromise;
+});
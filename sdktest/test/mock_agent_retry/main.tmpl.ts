@@ -0,0 +1,30 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import { sdktest } from "../../sdktestlib/sdk.js";
+
+sdktest.description("The mock API fails to serve the agent twice (503), the agent iframe load should be retried.");
+
+const mockAPI = {{ .MockAPI }};
+
+sdktest.test({ name: "one widget present" }, async (t) => {
+  t.require.numberOfWidgets(1);
+});
+
+sdktest.test({ name: "widget completes after agent retries", timeout: 30_000 }, async (t) => {
+  if (!mockAPI) {
+    t.skip();
+  }
+
+  const w = t.getWidget()!;
+  const completePromise = t.assert.widgetCompletes(w);
+  w.start();
+
+  await completePromise;
+
+  const agentIframe = document.querySelector("iframe.frc-i-agent");
+  t.assert.truthy(agentIframe?.getAttribute("src")?.includes("retry=2"), "agent should have loaded on the second retry");
+});
@@ -0,0 +1,26 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import { sdktest } from "../../sdktestlib/sdk.js";
+
+sdktest.description("The mock widget is interactive, it should complete after a (trusted) click on it.");
+
+const mockAPI = {{ .MockAPI }};
+
+sdktest.test({ name: "one widget present" }, async (t) => {
+  t.require.numberOfWidgets(1);
+});
+
+sdktest.test({ name: "widget completes after clicking it" }, async (t) => {
+  if (!mockAPI || !t.browser.available) {
+    t.skip();
+  }
+
+  const w = t.getWidget()!;
+  const completePromise = t.assert.widgetCompletes(w);
+  await t.browser.click(".mock-widget", { frame: ".frc-i-widget" });
+  await completePromise;
+});
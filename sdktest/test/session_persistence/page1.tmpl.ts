@@ -0,0 +1,27 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import { sdktest } from "../../sdktestlib/sdk.js";
+import { forgetSession, rememberSession, widgetSession } from "./session";
+
+sdktest.description("Remembers the session of the widget, then continues on page2.html.");
+
+forgetSession();
+sdktest.navigate("page2.html");
+
+sdktest.test({ name: "one widget present" }, async (t) => {
+  t.require.numberOfWidgets(1);
+});
+
+sdktest.test({ name: "widget has a session" }, async (t) => {
+  const session = widgetSession();
+  t.require.truthy(session, "the widget iframe should exist");
+  t.assert.truthy(session!.id, "sess_id should be set");
+  t.assert.truthy(session!.count > 0, "sess_c should be positive");
+  t.assert.equal(session!.id, sessionStorage.getItem("frc_sid"), "session ID should be stored");
+
+  rememberSession(session!);
+});
@@ -0,0 +1,33 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import { sdktest } from "../../sdktestlib/sdk.js";
+import { previousSession, reloadOnce, rememberSession, widgetSession } from "./session";
+
+sdktest.description("The session of the widget continues from the previous page, and after reloading.");
+
+if (reloadOnce()) {
+  sdktest.reload();
+}
+
+sdktest.test({ name: "one widget present" }, async (t) => {
+  t.require.numberOfWidgets(1);
+});
+
+sdktest.test({ name: "session continues" }, async (t) => {
+  const previous = previousSession();
+  if (!previous) {
+    t.skip(); // Opened by hand without starting on the first page.
+  }
+
+  const session = widgetSession();
+  t.require.truthy(session, "the widget iframe should exist");
+  t.assert.equal(previous!.id, session!.id, "sess_id should be the same");
+  t.assert.truthy(session!.count > previous!.count, `sess_c should increase, was ${previous!.count} and is ${session!.count}`);
+  t.assert.equal(session!.count.toString(), sessionStorage.getItem("frc_sc"), "session count should be stored");
+
+  rememberSession(session!);
+});
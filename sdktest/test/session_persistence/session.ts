@@ -0,0 +1,44 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+
+// The session the widget was created with, as passed to its iframe (see `FrameParams`).
+export type Session = { id: string; count: number };
+
+const KEY = "sdktest_session_persistence";
+
+export function widgetSession(): Session | undefined {
+  const frame = document.querySelector<HTMLIFrameElement>("iframe.frc-i-widget");
+  if (!frame) {
+    return undefined;
+  }
+  const params = new URL(frame.src).searchParams;
+  return { id: params.get("sess_id") || "", count: parseInt(params.get("sess_c") || "", 10) };
+}
+
+// The session of the page before this one.
+export function previousSession(): Session | undefined {
+  const s = sessionStorage.getItem(KEY);
+  return s ? JSON.parse(s) : undefined;
+}
+
+export function rememberSession(session: Session) {
+  sessionStorage.setItem(KEY, JSON.stringify(session));
+}
+
+// Whether the current page was already reloaded, it is reloaded once.
+export function reloadOnce(): boolean {
+  if (sessionStorage.getItem(KEY + "_reloaded")) {
+    return false;
+  }
+  sessionStorage.setItem(KEY + "_reloaded", "1");
+  return true;
+}
+
+export function forgetSession() {
+  sessionStorage.removeItem(KEY);
+  sessionStorage.removeItem(KEY + "_reloaded");
+}
@@ -0,0 +1,35 @@
+/*!
+ * Copyright (c) Friendly Captcha GmbH 2023.
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at https://mozilla.org/MPL/2.0/.
+ */
+import { sdktest } from "../../sdktestlib/sdk.js";
+
+sdktest.description("The connection is slow and drops for a few seconds, the widget should still complete.");
+
+sdktest.test({ name: "one widget present" }, async (t) => {
+  t.require.numberOfWidgets(1);
+});
+
+sdktest.test({ name: "widget completes on a slow connection that drops", timeout: 30_000 }, async (t) => {
+  const w = t.getWidget()!;
+  const completePromise = t.assert.widgetCompletes(w);
+  w.start();
+
+  await completePromise;
+});
+
+sdktest.test({ name: "browser reports being offline" }, async (t) => {
+  if (!t.browser.available) {
+    t.skip();
+  }
+  // Wait for the scheduled changes of the config to have happened, so they don't interfere.
+  await new Promise((r) => setTimeout(r, Math.max(0, 5500 - performance.now())));
+
+  await t.browser.setNetworkConditions({ offline: true });
+  t.assert.equal(false, navigator.onLine, "navigator.onLine should be false while offline");
+
+  await t.browser.setNetworkConditions({});
+  t.assert.equal(true, navigator.onLine, "navigator.onLine should be true again");
+});